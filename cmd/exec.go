@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+const (
+	// execReadyTimeout is how long to wait for the monitor to start before running the command anyway.
+	execReadyTimeout = 10 * time.Second
+
+	// execDrainTimeout is how long to keep reading events after the command exits, so that the stop events of its descendants are reported.
+	execDrainTimeout = 500 * time.Millisecond
+
+	// execSpillPollInterval is how often to check whether the events spilled to disk have been read once the command exits.
+	execSpillPollInterval = 10 * time.Millisecond
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec -- <command> [args...]",
+	Short: "Run a command and audit it and all of its descendants",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		setLogLevel(debug)
+
+		outputs, _ := cmd.Flags().GetStringSlice("output")
+		sink, err := monitor.OpenSinks(outputs)
+		if err != nil {
+			log.Fatalf("Failed to open output: %v", err)
+		}
+		f, err := getProcessFilter(cmd)
+		if err != nil {
+			log.Fatalf("Invalid process filter: %v", err)
+		}
+		opts, err := getAuditMonitorOptions(cmd)
+		if err != nil {
+			log.Fatalf("Invalid options: %v", err)
+		}
+		opts.TelemetryInterval = 0
+
+		// Ctrl-C is forwarded to the command, so keep reporting events until the command has exited.
+		opts.IgnoreSignals = true
+
+		// The command is started by a copy of go-audit which waits for the monitor to start, so that the PID of its parent is known before it runs.
+		child, release, err := startExecChild(args)
+		if err != nil {
+			log.Fatalf("Failed to start command: %v", err)
+		}
+		if len(f.AncestorPIDs) > 0 {
+			log.Warnf("Ignoring ancestor PIDs, only the command and its descendants are reported")
+		}
+		f.AncestorPIDs = []int32{int32(child.Process.Pid)}
+
+		m, err := monitor.NewAuditMonitor(f, opts)
+		if err != nil {
+			release.Close()
+			child.Wait()
+			log.Fatalf("Failed to create process monitor: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			err := m.Run(ctx)
+			if err != nil {
+				log.Errorf("Monitor failed: %v", err)
+			}
+		}()
+
+		summary := newExecSummary()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			forwardEvents(m, stopped, func(e monitor.Event) {
+				summary.Add(e)
+				err := sink.Write(e)
+				if err != nil {
+					log.Errorf("Failed to write event: %v", err)
+				}
+			})
+		}()
+
+		select {
+		case <-m.Ready():
+		case <-time.After(execReadyTimeout):
+			log.Warnf("Timed out waiting for the monitor to start, some processes may not be reported")
+		}
+
+		err = releaseExecChild(release)
+		if err != nil {
+			log.Errorf("Failed to start command: %v", err)
+		}
+		code := waitCommand(child)
+
+		time.Sleep(execDrainTimeout)
+
+		// Events which were spilled to disk are lost once the monitor stops, so wait for them to be read too.
+	drain:
+		for m.SpillQueueLength() > 0 {
+			select {
+			case <-stopped:
+				break drain
+			case <-time.After(execSpillPollInterval):
+			}
+		}
+		cancel()
+		<-done
+
+		err = sink.Close()
+		if err != nil {
+			log.Errorf("Failed to close output: %v", err)
+		}
+		if printSummary, _ := cmd.Flags().GetBool("summary"); printSummary {
+			summary.Write(os.Stderr)
+		}
+		os.Exit(code)
+	},
+}
+
+// execChildCmd runs a command once the go-audit process which started it has written a byte to file descriptor 3, and exits with its exit code.
+var execChildCmd = &cobra.Command{
+	Use:                "exec-child <command> [args...]",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Args:               cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := os.NewFile(3, "release")
+		released := waitForRelease(f)
+		f.Close()
+		if !released {
+			os.Exit(1)
+		}
+		os.Exit(runCommand(args))
+	},
+}
+
+// startExecChild starts a command through exec-child, and returns the pipe used to release it.
+func startExecChild(args []string) (*exec.Cmd, *os.File, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to find go-audit executable")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create pipe")
+	}
+	defer r.Close()
+
+	c := exec.Command(path, append([]string{execChildCmd.Name()}, args...)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.ExtraFiles = []*os.File{r}
+	err = c.Start()
+	if err != nil {
+		w.Close()
+		return nil, nil, err
+	}
+	return c, w, nil
+}
+
+// releaseExecChild lets a command started by startExecChild run.
+func releaseExecChild(w *os.File) error {
+	defer w.Close()
+	_, err := w.Write([]byte{1})
+	return err
+}
+
+// waitForRelease blocks until a byte has been read, and returns false if the pipe was closed without one (i.e. the command shouldn't be run).
+func waitForRelease(r io.Reader) bool {
+	b := make([]byte, 1)
+	n, _ := io.ReadFull(r, b)
+	return n == 1
+}
+
+// runCommand runs a command with our standard streams and returns its exit code.
+func runCommand(args []string) int {
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	err := c.Start()
+	if err != nil {
+		log.Errorf("Failed to start command: %v", err)
+		return 127
+	}
+	log.Infof("Started %s (PID: %d)", args[0], c.Process.Pid)
+	return waitCommand(c)
+}
+
+// waitCommand waits for a command to exit, forwarding SIGINT and SIGTERM to it, and returns its exit code.
+func waitCommand(c *exec.Cmd) int {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		for sig := range sigCh {
+			c.Process.Signal(sig)
+		}
+	}()
+
+	err := c.Wait()
+	if err == nil {
+		return 0
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		log.Errorf("Failed to wait for command: %v", err)
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// execSummary records the processes reported while a command was running.
+type execSummary struct {
+	processes map[int32]*monitor.Process
+	exits     map[int32]*monitor.ProcessStopEventData
+}
+
+func newExecSummary() *execSummary {
+	return &execSummary{
+		processes: make(map[int32]*monitor.Process),
+		exits:     make(map[int32]*monitor.ProcessStopEventData),
+	}
+}
+
+// Add records a process started or stopped event, including those replayed from the spill queue.
+func (s *execSummary) Add(e monitor.Event) {
+	switch data := e.Data.(type) {
+	case monitor.ProcessStartEventData:
+		p := data.Process
+		s.processes[p.PID] = &p
+	case monitor.ProcessStopEventData:
+		s.exits[data.PID] = &data
+	}
+}
+
+func (s *execSummary) Write(w io.Writer) {
+	nodes := make(map[int32]*treeNode, len(s.processes))
+	ppids := make(map[int32]int32, len(s.processes))
+	for pid, p := range s.processes {
+		nodes[pid] = &treeNode{
+			PID:   pid,
+			Label: s.getLabel(p),
+		}
+		ppids[pid] = p.PPID
+	}
+	fmt.Fprintf(w, "\n%d processes:\n", len(nodes))
+	writeTextTree(w, buildTree(nodes, ppids))
+}
+
+func (s *execSummary) getLabel(p *monitor.Process) string {
+	name := p.Name
+	if name == "" {
+		name = "?"
+	}
+	label := fmt.Sprintf("%s (PID: %d)", name, p.PID)
+	if exit, ok := s.exits[p.PID]; ok {
+		if exit.Signal != nil {
+			label += fmt.Sprintf(" [signal: %d]", *exit.Signal)
+		} else if exit.ExitCode != nil {
+			label += fmt.Sprintf(" [exit code: %d]", *exit.ExitCode)
+		}
+	}
+	if len(p.Argv) > 0 {
+		label += " " + formatArgv(p.Argv)
+	}
+	return label
+}
+
+func init() {
+	execCmd.PersistentFlags().StringSlice("output", []string{"stderr"}, "Where to write events (see run --output), stderr by default to keep them apart from the output of the command")
+	execCmd.PersistentFlags().Bool("summary", true, "Print a tree of the processes that ran once the command exits")
+	addProcessFilterFlags(execCmd)
+	addAuditMonitorFlags(execCmd)
+
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(execChildCmd)
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+// TestMain lets the test binary stand in for go-audit when startExecChild re-executes itself.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == execChildCmd.Name() {
+		execChildCmd.Run(execChildCmd, os.Args[2:])
+	}
+	os.Exit(m.Run())
+}
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{args: []string{"true"}, expected: 0},
+		{args: []string{"sh", "-c", "exit 3"}, expected: 3},
+		{args: []string{"sh", "-c", "kill -TERM $$"}, expected: 128 + 15},
+		{args: []string{"/nonexistent/command"}, expected: 127},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, runCommand(test.args), test.args)
+	}
+}
+
+func TestWaitForRelease(t *testing.T) {
+	assert.True(t, waitForRelease(bytes.NewReader([]byte{1})))
+	assert.False(t, waitForRelease(bytes.NewReader(nil)))
+}
+
+func TestExecChild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ran")
+	child, release, err := startExecChild([]string{"sh", "-c", "touch " + path + "; exit 5"})
+	assert.Nil(t, err)
+
+	// The command doesn't run until it's released.
+	time.Sleep(100 * time.Millisecond)
+	assert.NoFileExists(t, path)
+
+	assert.Nil(t, releaseExecChild(release))
+	assert.Equal(t, 5, waitCommand(child))
+	assert.FileExists(t, path)
+}
+
+func TestExecChildNotReleased(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ran")
+	child, release, err := startExecChild([]string{"touch", path})
+	assert.Nil(t, err)
+
+	// The command never runs if the pipe is closed without releasing it (e.g. because the monitor failed to start).
+	release.Close()
+	assert.Equal(t, 1, waitCommand(child))
+	assert.NoFileExists(t, path)
+}
+
+func TestExecSummary(t *testing.T) {
+	code := 2
+	signal := 9
+	events := []monitor.Event{
+		monitor.NewEvent(monitor.ObjectTypeProcess, monitor.EventTypeStarted, monitor.ProcessStartEventData{
+			Process: monitor.Process{PID: 100, PPID: 1, Name: "make", Argv: []string{"make", "all"}},
+		}),
+		monitor.NewEvent(monitor.ObjectTypeProcess, monitor.EventTypeStarted, monitor.ProcessStartEventData{
+			Process: monitor.Process{PID: 101, PPID: 100, Name: "cc"},
+		}),
+		monitor.NewEvent(monitor.ObjectTypeProcess, monitor.EventTypeStarted, monitor.ProcessStartEventData{
+			Process: monitor.Process{PID: 102, PPID: 100},
+		}),
+		monitor.NewEvent(monitor.ObjectTypeProcess, monitor.EventTypeStopped, monitor.ProcessStopEventData{PID: 101, ExitCode: &code}),
+		monitor.NewEvent(monitor.ObjectTypeProcess, monitor.EventTypeStopped, monitor.ProcessStopEventData{PID: 102, Signal: &signal}),
+	}
+
+	// Events replayed from the spill queue have been through JSON.
+	spilled := make([]monitor.Event, len(events))
+	for i, e := range events {
+		b, err := json.Marshal(e)
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(b, &spilled[i]))
+	}
+
+	expected := strings.Join([]string{
+		"",
+		"3 processes:",
+		"make (PID: 100) make all",
+		"├── cc (PID: 101) [exit code: 2]",
+		"└── ? (PID: 102) [signal: 9]",
+		"",
+	}, "\n")
+	for _, events := range [][]monitor.Event{events, spilled} {
+		s := newExecSummary()
+		for _, e := range events {
+			s.Add(e)
+		}
+		var buf bytes.Buffer
+		s.Write(&buf)
+		assert.Equal(t, expected, buf.String())
+	}
+}
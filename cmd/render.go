@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+type treeNode struct {
+	Label    string
+	PID      int32
+	Process  *monitor.Process
+	Children []*treeNode
+}
+
+// buildTree links nodes to their parents, returning the nodes whose parent isn't in the tree (i.e. the roots).
+func buildTree(nodes map[int32]*treeNode, ppids map[int32]int32) []*treeNode {
+	var roots []*treeNode
+	for pid, node := range nodes {
+		parent, ok := nodes[ppids[pid]]
+		if !ok || parent == node {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	for _, node := range nodes {
+		sortTreeNodes(node.Children)
+	}
+	sortTreeNodes(roots)
+	return roots
+}
+
+func sortTreeNodes(nodes []*treeNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].PID < nodes[j].PID
+	})
+}
+
+var argvEscaper = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// formatArgv joins the arguments of a process into a single line.
+func formatArgv(argv []string) string {
+	return argvEscaper.Replace(strings.Join(argv, " "))
+}
+
+// writeTextTree writes an indented ASCII tree (e.g. like pstree).
+func writeTextTree(w io.Writer, roots []*treeNode) {
+	for _, root := range roots {
+		fmt.Fprintln(w, root.Label)
+		writeTextSubtree(w, root.Children, "")
+	}
+}
+
+func writeTextSubtree(w io.Writer, nodes []*treeNode, prefix string) {
+	for i, node := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, branch, node.Label)
+		writeTextSubtree(w, node.Children, prefix+indent)
+	}
+}
+
+type jsonTreeNode struct {
+	*monitor.Process
+	Children []*jsonTreeNode `json:"children,omitempty"`
+}
+
+func newJSONTreeNode(node *treeNode) *jsonTreeNode {
+	n := &jsonTreeNode{
+		Process: node.Process,
+	}
+	if n.Process == nil {
+		n.Process = &monitor.Process{PID: node.PID}
+	}
+	for _, child := range node.Children {
+		n.Children = append(n.Children, newJSONTreeNode(child))
+	}
+	return n
+}
+
+// writeJSONTree writes the roots as a JSON array of processes, each with a nested array of children.
+func writeJSONTree(w io.Writer, roots []*treeNode) error {
+	nodes := make([]*jsonTreeNode, 0, len(roots))
+	for _, root := range roots {
+		nodes = append(nodes, newJSONTreeNode(root))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(nodes)
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeDotTree writes a Graphviz digraph with an edge from each parent to each of its children.
+func writeDotTree(w io.Writer, roots []*treeNode) {
+	fmt.Fprintln(w, "digraph processes {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	var walk func(nodes []*treeNode)
+	walk = func(nodes []*treeNode) {
+		for _, node := range nodes {
+			fmt.Fprintf(w, "  %d [label=\"%s\"];\n", node.PID, dotEscaper.Replace(node.Label))
+			for _, child := range node.Children {
+				fmt.Fprintf(w, "  %d -> %d;\n", node.PID, child.PID)
+			}
+			walk(node.Children)
+		}
+	}
+	walk(roots)
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSONTree(t *testing.T) {
+	tree, processes := newTestProcessTree()
+	tests := []struct {
+		pid      int32
+		expected []map[string]interface{}
+	}{
+		{
+			pid: 301,
+			expected: []map[string]interface{}{
+				{"pid": 301.0, "ppid": 200.0, "name": "make", "children": []interface{}{
+					map[string]interface{}{"pid": 400.0, "ppid": 301.0, "name": "cc"},
+				}},
+			},
+		},
+		{
+			// Processes which aren't in the process list only have a PID.
+			pid: 100,
+			expected: []map[string]interface{}{
+				{"pid": 100.0, "ppid": 0.0, "children": []interface{}{
+					map[string]interface{}{"pid": 200.0, "ppid": 100.0, "name": "bash", "argv": []interface{}{"-bash"}, "children": []interface{}{
+						map[string]interface{}{"pid": 300.0, "ppid": 200.0, "name": "vim", "argv": []interface{}{"vim", "notes.txt"}},
+						map[string]interface{}{"pid": 301.0, "ppid": 200.0, "name": "make", "children": []interface{}{
+							map[string]interface{}{"pid": 400.0, "ppid": 301.0, "name": "cc"},
+						}},
+					}},
+				}},
+			},
+		},
+		{
+			pid:      12345,
+			expected: []map[string]interface{}{},
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := writeJSONTree(&buf, getProcessTreeRoots(tree, processes, processes, test.pid))
+		assert.Nil(t, err)
+		var actual []map[string]interface{}
+		assert.Nil(t, json.Unmarshal(buf.Bytes(), &actual))
+		assert.Equal(t, test.expected, actual, test.pid)
+	}
+}
+
+func TestWriteDotTree(t *testing.T) {
+	tree, processes := newTestProcessTree()
+	tests := []struct {
+		roots    []*treeNode
+		expected string
+	}{
+		{
+			roots: getProcessTreeRoots(tree, processes, processes, 200),
+			expected: `digraph processes {
+  node [shape=box];
+  200 [label="bash (PID: 200) -bash"];
+  200 -> 300;
+  200 -> 301;
+  300 [label="vim (PID: 300) vim notes.txt"];
+  301 [label="make (PID: 301)"];
+  301 -> 400;
+  400 [label="cc (PID: 400)"];
+}
+`,
+		},
+		{
+			// Labels are escaped.
+			roots: []*treeNode{{PID: 1, Label: `sh -c "echo \n"` + "\nx"}},
+			expected: `digraph processes {
+  node [shape=box];
+  1 [label="sh -c \"echo \\n\"\nx"];
+}
+`,
+		},
+		{
+			expected: "digraph processes {\n  node [shape=box];\n}\n",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		writeDotTree(&buf, test.roots)
+		assert.Equal(t, test.expected, buf.String())
+	}
+}
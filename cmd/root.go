@@ -2,15 +2,16 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"os"
 	"os/signal"
-	"sync"
+	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
 	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+	"github.com/whitfieldsdad/go-audit/pkg/util"
 )
 
 var rootCmd = &cobra.Command{
@@ -25,52 +26,192 @@ var runCmd = &cobra.Command{
 		debug, _ := cmd.Flags().GetBool("debug")
 		setLogLevel(debug)
 
-		ctx := context.Background()
-
-		// Handle SIGINT and SIGTERM.
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, os.Interrupt)
-		go func() {
-			<-sigCh
-			log.Info("Shutting down...")
-			os.Exit(0)
-		}()
-
-		f := &monitor.ProcessFilter{}
-		ancestorPids, _ := cmd.Flags().GetInt32Slice("ancestor-pid")
-		f.AncestorPIDs = ancestorPids
+		outputs, _ := cmd.Flags().GetStringSlice("output")
+		sink, err := monitor.OpenSinks(outputs)
+		if err != nil {
+			log.Fatalf("Failed to open output: %v", err)
+		}
 
-		monitor, err := monitor.NewAuditMonitor(f)
+		f, err := getProcessFilter(cmd)
+		if err != nil {
+			log.Fatalf("Invalid process filter: %v", err)
+		}
+		opts, err := getAuditMonitorOptions(cmd)
+		if err != nil {
+			log.Fatalf("Invalid options: %v", err)
+		}
+		opts.Snapshot, _ = cmd.Flags().GetBool("snapshot")
+		opts.HostInventoryInterval, _ = cmd.Flags().GetDuration("host-inventory-interval")
+		opts.StatePath, _ = cmd.Flags().GetString("state-path")
+		opts.StateInterval, _ = cmd.Flags().GetDuration("state-interval")
+		opts.NetworkInterval, _ = cmd.Flags().GetDuration("network-interval")
+		opts.ModuleInterval, _ = cmd.Flags().GetDuration("module-interval")
+		opts.Files = getFileMonitorOptions(cmd)
+		if opts.Files != nil {
+			opts.Files.IncludeHashes = opts.IncludeHashes
+			opts.Files.IncludeELF = opts.IncludeELF
+		}
+		// SIGINT and SIGTERM stop the monitor, which saves its state before returning, and the sink is closed once the remaining events have been written.
+		opts.IgnoreSignals = true
+		m, err := monitor.NewAuditMonitor(f, opts)
 		if err != nil {
 			log.Fatalf("Failed to create process monitor: %v", err)
 		}
-
-		// Run the monitor in a goroutine.
-		var wg sync.WaitGroup
-		wg.Add(1)
-
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		stopped := make(chan struct{})
 		go func() {
-			defer wg.Done()
-			err := monitor.Run(ctx)
+			defer close(stopped)
+			err := m.Run(ctx)
 			if err != nil {
 				log.Errorf("Monitor failed: %v", err)
 			}
 		}()
+		go func() {
+			<-ctx.Done()
+			log.Info("Shutting down...")
+
+			// A second signal exits immediately.
+			stop()
+		}()
 
-		// Continuously read events from the monitor.
-		for {
-			select {
-			case event := <-monitor.Events:
-				b, err := json.Marshal(event)
-				if err != nil {
-					log.Fatalf("Failed to marshal event: %v", err)
-				}
-				fmt.Println(string(b))
+		forwardEvents(m, stopped, func(e monitor.Event) {
+			err := sink.Write(e)
+			if err != nil {
+				log.Errorf("Failed to write event: %v", err)
 			}
+		})
+		err = sink.Close()
+		if err != nil {
+			log.Errorf("Failed to close output: %v", err)
 		}
 	},
 }
 
+// forwardEvents passes each event emitted by the monitor to the given function until the monitor has stopped and all of its remaining events have been read.
+func forwardEvents(m *monitor.AuditMonitor, stopped <-chan struct{}, write func(monitor.Event)) {
+	for {
+		select {
+		case e := <-m.Events:
+			write(e)
+		case <-stopped:
+			for {
+				select {
+				case e := <-m.Events:
+					write(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func getFileMonitorOptions(cmd *cobra.Command) *monitor.FileMonitorOptions {
+	paths, _ := cmd.Flags().GetStringSlice("watch")
+	if len(paths) == 0 {
+		return nil
+	}
+	opts := monitor.GetDefaultFileMonitorOptions()
+	opts.Paths = paths
+	opts.Backend, _ = cmd.Flags().GetString("watch-backend")
+	opts.Mount, _ = cmd.Flags().GetBool("watch-mount")
+	opts.Events, _ = cmd.Flags().GetStringSlice("watch-events")
+	opts.Recursive, _ = cmd.Flags().GetBool("watch-recursive")
+	opts.Include, _ = cmd.Flags().GetStringSlice("watch-include")
+	opts.Exclude, _ = cmd.Flags().GetStringSlice("watch-exclude")
+	opts.Debounce, _ = cmd.Flags().GetDuration("watch-debounce")
+	return opts
+}
+
+func getProcessFilter(cmd *cobra.Command) (*monitor.ProcessFilter, error) {
+	f := &monitor.ProcessFilter{}
+	path, _ := cmd.Flags().GetString("filter-file")
+	if path != "" {
+		var err error
+		f, err = monitor.ReadProcessFilterFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ancestorPids, _ := cmd.Flags().GetInt32Slice("ancestor-pid")
+	f.AncestorPIDs = append(f.AncestorPIDs, ancestorPids...)
+
+	users, _ := cmd.Flags().GetStringSlice("user")
+	f.Users = append(f.Users, users...)
+	containerIds, _ := cmd.Flags().GetStringSlice("container")
+	f.ContainerIds = append(f.ContainerIds, containerIds...)
+	cgroups, _ := cmd.Flags().GetStringSlice("cgroup")
+	f.Cgroups = append(f.Cgroups, cgroups...)
+
+	include, _ := cmd.Flags().GetStringArray("include")
+	for _, s := range include {
+		r, err := monitor.ParseProcessRule(s)
+		if err != nil {
+			return nil, err
+		}
+		f.Include = append(f.Include, r)
+	}
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	for _, s := range exclude {
+		r, err := monitor.ParseProcessRule(s)
+		if err != nil {
+			return nil, err
+		}
+		f.Exclude = append(f.Exclude, r)
+	}
+	return f, nil
+}
+
+func getAuditMonitorOptions(cmd *cobra.Command) (*monitor.AuditMonitorOptions, error) {
+	opts := monitor.GetDefaultAuditMonitorOptions()
+	opts.Backend, _ = cmd.Flags().GetString("backend")
+	opts.AuditLogPath, _ = cmd.Flags().GetString("audit-log")
+	opts.OverflowPolicy, _ = cmd.Flags().GetString("overflow")
+	opts.SpillPath, _ = cmd.Flags().GetString("spill-path")
+	opts.TelemetryInterval, _ = cmd.Flags().GetDuration("telemetry-interval")
+	opts.IncludeHashes, _ = cmd.Flags().GetBool("hashes")
+	opts.HashWorkers, _ = cmd.Flags().GetInt("hash-workers")
+	opts.HashDeadline, _ = cmd.Flags().GetDuration("hash-deadline")
+	opts.IncludeAncestors, _ = cmd.Flags().GetBool("ancestors")
+	opts.IncludeHost, _ = cmd.Flags().GetBool("host")
+	opts.IncludeUser, _ = cmd.Flags().GetBool("users")
+	opts.IncludeCwd, _ = cmd.Flags().GetBool("cwd")
+	opts.IncludeSession, _ = cmd.Flags().GetBool("session")
+	opts.Environment, _ = cmd.Flags().GetStringSlice("env")
+	opts.IncludeModules, _ = cmd.Flags().GetBool("modules")
+	opts.IncludeELF, _ = cmd.Flags().GetBool("elf")
+
+	var err error
+	opts.HashOptions, err = getHashOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func getHashOptions(cmd *cobra.Command) (*monitor.HashOptions, error) {
+	opts := monitor.GetDefaultHashOptions()
+	opts.Algorithms, _ = cmd.Flags().GetStringSlice("hash-algorithms")
+
+	var err error
+	maxSize, _ := cmd.Flags().GetString("hash-max-size")
+	if maxSize != "" {
+		opts.MaxSize, err = util.ParseByteSize(maxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	partialSize, _ := cmd.Flags().GetString("hash-partial-size")
+	if partialSize != "" {
+		opts.PartialSize, err = util.ParseByteSize(partialSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opts, opts.Validate()
+}
+
 func setLogLevel(debug bool) {
 	var level log.Level
 	if debug {
@@ -84,10 +225,66 @@ func setLogLevel(debug bool) {
 func init() {
 	rootCmd.PersistentFlags().BoolP("debug", "d", false, "Debug")
 	runCmd.PersistentFlags().Int32Slice("ancestor-pid", []int32{}, "Ancestor PIDs")
+	runCmd.PersistentFlags().StringSlice("output", []string{"stdout"}, "Where to write events (e.g. stdout, file:///var/log/go-audit.jsonl?max_size=100MB&max_age=24h&max_backups=5&compress=true, unix:///run/go-audit.sock)")
+	runCmd.PersistentFlags().Bool("snapshot", false, "Emit a running event for each process which was already running when the monitor started")
+	runCmd.PersistentFlags().String("state-path", "", "Path to a file used to remember the running processes between restarts, so that processes which started or stopped in the meantime are reported")
+	runCmd.PersistentFlags().Duration("state-interval", 10*time.Second, "How often to save the state to --state-path")
+	runCmd.PersistentFlags().Duration("telemetry-interval", time.Minute, "How often to emit a telemetry event with event and drop counters (0 to disable)")
+	runCmd.PersistentFlags().Duration("host-inventory-interval", time.Hour, "How often to emit a host inventory event, including when the monitor starts (0 to disable)")
+	runCmd.PersistentFlags().Duration("module-interval", 0, "How often to check for shared libraries loaded by running processes (e.g. 5s, 0 to disable; Linux only)")
+	runCmd.PersistentFlags().Duration("network-interval", 0, "How often to poll for TCP and UDP sockets which have been opened or closed (e.g. 1s, 0 to disable)")
+	runCmd.PersistentFlags().StringSlice("watch", []string{}, "Report files which are created, modified, deleted, or renamed in these directories (e.g. /etc,/var/spool/cron)")
+	runCmd.PersistentFlags().String("watch-backend", monitor.FileBackendFsnotify, "How to watch files (fsnotify, or fanotify to report which process opened, executed, modified, or wrote each file on Linux)")
+	runCmd.PersistentFlags().Bool("watch-mount", false, "Watch the whole mount containing each --watch path (fanotify only)")
+	runCmd.PersistentFlags().StringSlice("watch-events", []string{}, "File accesses to report (fanotify only): open, exec, modify, close_write (default all)")
+	runCmd.PersistentFlags().Bool("watch-recursive", true, "Also watch the subdirectories of --watch directories")
+	runCmd.PersistentFlags().StringSlice("watch-include", []string{}, "Only report files matching these globs (e.g. /etc/**.conf)")
+	runCmd.PersistentFlags().StringSlice("watch-exclude", []string{}, "Don't report files matching these globs (e.g. **.swp)")
+	runCmd.PersistentFlags().Duration("watch-debounce", 500*time.Millisecond, "How long a file must go unchanged before it's reported")
+	addProcessFilterFlags(runCmd)
+	addAuditMonitorFlags(runCmd)
 
 	rootCmd.AddCommand(runCmd)
 }
 
+func addProcessFilterFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringArray("include", []string{}, "Only include processes matching a rule (e.g. name=python*, exe=/opt/agent/**, argv=--config, user=root, parent_name=sshd, hash=<md5|sha1|sha256>)")
+	cmd.PersistentFlags().StringArray("exclude", []string{}, "Exclude processes matching a rule (same syntax as --include)")
+	cmd.PersistentFlags().String("filter-file", "", "Path to a JSON process filter")
+	cmd.PersistentFlags().StringSlice("user", []string{}, "Only include processes owned by these users (usernames or UIDs)")
+	cmd.PersistentFlags().StringSlice("container", []string{}, "Only include processes running in these containers (IDs or ID prefixes)")
+	cmd.PersistentFlags().StringSlice("cgroup", []string{}, "Only include processes in these cgroups or their descendants (e.g. /kubepods.slice)")
+}
+
+func addAuditMonitorFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("backend", monitor.BackendAuto, "Backend (auto, poll, proc-connector, auditd, audit-log)")
+	cmd.PersistentFlags().String("audit-log", monitor.DefaultAuditLogPath, "Path to the audit log to follow when using the audit-log backend")
+	cmd.PersistentFlags().String("overflow", monitor.OverflowBlock, "What to do when events are produced faster than they can be written (block, drop-newest, drop-oldest, spill)")
+	cmd.PersistentFlags().String("spill-path", "", "Path to the on-disk queue used by the spill overflow policy")
+	cmd.PersistentFlags().Bool("hashes", true, "Hash the executable of each new process")
+	cmd.PersistentFlags().Int("hash-workers", runtime.NumCPU(), "Number of executables to hash concurrently")
+	addHashFlags(cmd)
+	cmd.PersistentFlags().Duration("hash-deadline", 0, "How long to wait for an executable to be hashed before sending its process started event without hashes (followed by an enriched event)")
+	addProcessDetailFlags(cmd)
+	cmd.PersistentFlags().Bool("host", false, "Include the details of the host in the header of every event (the host ID is always included)")
+	cmd.PersistentFlags().Bool("ancestors", false, "Include the PID, name, executable, and command line of every ancestor of each new process")
+}
+
+func addProcessDetailFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("users", false, "Include the details of the user that owns each process (its credentials and username are always included)")
+	cmd.PersistentFlags().Bool("cwd", false, "Include the working directory of each process")
+	cmd.PersistentFlags().Bool("session", false, "Include the session ID, process group ID, and controlling terminal of each process")
+	cmd.PersistentFlags().StringSlice("env", []string{}, "Include these environment variables of each process (e.g. SSH_CONNECTION,SUDO_USER,LD_PRELOAD)")
+	cmd.PersistentFlags().Bool("elf", false, "Include the ELF metadata of the executable of each process (e.g. its interpreter, build ID, imported libraries, and section entropy), and of each file reported by --watch")
+	cmd.PersistentFlags().Bool("modules", false, "Include the path, base address, and hashes of the shared libraries mapped by each process (Linux only)")
+}
+
+func addHashFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSlice("hash-algorithms", monitor.GetDefaultHashOptions().Algorithms, "Hash algorithms (md5, sha1, sha256, sha512, blake3, crc32, xxh3)")
+	cmd.PersistentFlags().String("hash-max-size", "", "Only hash the head and tail of executables larger than this size (e.g. 512MB)")
+	cmd.PersistentFlags().String("hash-partial-size", "", "Number of bytes to hash from the head and tail of executables larger than --hash-max-size (default 4MB)")
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
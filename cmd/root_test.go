@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+func TestForwardEvents(t *testing.T) {
+	m, err := monitor.NewAuditMonitor(nil, monitor.GetDefaultAuditMonitorOptions())
+	assert.Nil(t, err)
+	m.Events = make(chan monitor.Event, 3)
+	for i := 0; i < 3; i++ {
+		m.Events <- monitor.NewEvent(monitor.ObjectTypeProcess, monitor.EventTypeStarted, monitor.ProcessStartEventData{Process: monitor.Process{PID: int32(i)}})
+	}
+
+	// The events which are still queued when the monitor stops are written before returning.
+	stopped := make(chan struct{})
+	close(stopped)
+	var written []int32
+	forwardEvents(m, stopped, func(e monitor.Event) {
+		written = append(written, e.Data.(monitor.ProcessStartEventData).PID)
+	})
+	assert.Equal(t, []int32{0, 1, 2}, written)
+}
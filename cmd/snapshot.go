@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:     "snapshot",
+	Aliases: []string{"ps"},
+	Short:   "Emit a running event for each running process",
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		setLogLevel(debug)
+
+		outputs, _ := cmd.Flags().GetStringSlice("output")
+		sink, err := monitor.OpenSinks(outputs)
+		if err != nil {
+			log.Fatalf("Failed to open output: %v", err)
+		}
+		f, err := getProcessFilter(cmd)
+		if err != nil {
+			log.Fatalf("Invalid process filter: %v", err)
+		}
+		err = f.Compile()
+		if err != nil {
+			log.Fatalf("Invalid process filter: %v", err)
+		}
+		opts := monitor.GetDefaultProcessOptions()
+		opts.IncludeHashes, _ = cmd.Flags().GetBool("hashes")
+		opts.IncludeAncestors, _ = cmd.Flags().GetBool("ancestors")
+		opts.IncludeUser, _ = cmd.Flags().GetBool("users")
+		opts.IncludeCwd, _ = cmd.Flags().GetBool("cwd")
+		opts.IncludeSession, _ = cmd.Flags().GetBool("session")
+		opts.Environment, _ = cmd.Flags().GetStringSlice("env")
+		opts.IncludeModules, _ = cmd.Flags().GetBool("modules")
+		opts.IncludeELF, _ = cmd.Flags().GetBool("elf")
+		opts.HashOptions, err = getHashOptions(cmd)
+		if err != nil {
+			log.Fatalf("Invalid options: %v", err)
+		}
+
+		events, err := monitor.GetProcessSnapshot(f, opts)
+		if err != nil {
+			log.Fatalf("Failed to list processes: %v", err)
+		}
+		for _, e := range events {
+			err := sink.Write(e)
+			if err != nil {
+				log.Errorf("Failed to write event: %v", err)
+			}
+		}
+		err = sink.Close()
+		if err != nil {
+			log.Fatalf("Failed to close output: %v", err)
+		}
+	},
+}
+
+func init() {
+	snapshotCmd.PersistentFlags().StringSlice("output", []string{"stdout"}, "Where to write events (see run --output)")
+	snapshotCmd.PersistentFlags().Int32Slice("ancestor-pid", []int32{}, "Ancestor PIDs")
+	snapshotCmd.PersistentFlags().Bool("hashes", true, "Hash the executable of each process")
+	snapshotCmd.PersistentFlags().Bool("ancestors", false, "Include the PID, name, executable, and command line of every ancestor of each process")
+	addProcessDetailFlags(snapshotCmd)
+	addHashFlags(snapshotCmd)
+	addProcessFilterFlags(snapshotCmd)
+
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+const (
+	treeFormatText = "text"
+	treeFormatJSON = "json"
+	treeFormatDot  = "dot"
+)
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Print the tree of running processes",
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		setLogLevel(debug)
+
+		format, _ := cmd.Flags().GetString("format")
+		switch format {
+		case treeFormatText, treeFormatJSON, treeFormatDot:
+		default:
+			log.Fatalf("Unsupported format: %s", format)
+		}
+		f, err := getProcessFilter(cmd)
+		if err != nil {
+			log.Fatalf("Invalid process filter: %v", err)
+		}
+		err = f.Compile()
+		if err != nil {
+			log.Fatalf("Invalid process filter: %v", err)
+		}
+
+		tree, err := monitor.GetProcessTree()
+		if err != nil {
+			log.Fatalf("Failed to get process tree: %v", err)
+		}
+		processes, err := monitor.ListProcesses(&monitor.ProcessOptions{})
+		if err != nil {
+			log.Fatalf("Failed to list processes: %v", err)
+		}
+		pid, _ := cmd.Flags().GetInt32("pid")
+		roots := getProcessTreeRoots(tree, processes, f.FilterProcesses(processes, tree, nil), pid)
+
+		switch format {
+		case treeFormatText:
+			writeTextTree(os.Stdout, roots)
+		case treeFormatJSON:
+			err = writeJSONTree(os.Stdout, roots)
+		case treeFormatDot:
+			writeDotTree(os.Stdout, roots)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write process tree: %v", err)
+		}
+	},
+}
+
+// getProcessTreeRoots builds a tree of the matching processes, rooted at pid (if set). The ancestors of each matching process are also included so that every process is shown beneath its ancestors.
+func getProcessTreeRoots(tree *monitor.ProcessTree, processes, matched []monitor.Process, pid int32) []*treeNode {
+	byPid := make(map[int32]*monitor.Process, len(processes))
+	for i := range processes {
+		byPid[processes[i].PID] = &processes[i]
+	}
+	nodes := make(map[int32]*treeNode)
+	ppids := make(map[int32]int32)
+	add := func(pid int32) bool {
+		if _, ok := nodes[pid]; ok {
+			return false
+		}
+		node := &treeNode{PID: pid, Label: fmt.Sprintf("? (PID: %d)", pid)}
+		if p, ok := byPid[pid]; ok {
+			node.Process = p
+			node.Label = getProcessTreeLabel(p)
+		}
+		nodes[pid] = node
+		ppids[pid], _ = tree.GetParentPid(pid)
+		return true
+	}
+	for _, p := range matched {
+		if pid != 0 && p.PID != pid && !tree.IsDescendantOf(p.PID, pid) {
+			continue
+		}
+		if !add(p.PID) || p.PID == pid {
+			continue
+		}
+		for _, ancestor := range tree.GetAncestorPids(p.PID) {
+			if ancestor <= 0 || !add(ancestor) || ancestor == pid {
+				break
+			}
+		}
+	}
+	return buildTree(nodes, ppids)
+}
+
+func getProcessTreeLabel(p *monitor.Process) string {
+	name := p.Name
+	if name == "" {
+		name = "?"
+	}
+	label := fmt.Sprintf("%s (PID: %d)", name, p.PID)
+	if len(p.Argv) > 0 {
+		label += " " + formatArgv(p.Argv)
+	}
+	return label
+}
+
+func init() {
+	treeCmd.PersistentFlags().Int32("pid", 0, "Only print the subtree rooted at this PID")
+	treeCmd.PersistentFlags().String("format", treeFormatText, "Output format (text, json, dot)")
+	treeCmd.PersistentFlags().Int32Slice("ancestor-pid", []int32{}, "Only print processes which are descendants of these PIDs (along with their ancestors)")
+	addProcessFilterFlags(treeCmd)
+
+	rootCmd.AddCommand(treeCmd)
+}
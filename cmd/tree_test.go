@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/whitfieldsdad/go-audit/pkg/monitor"
+)
+
+// newTestProcessTree returns a synthetic tree of processes, where sshd (PID 100) is missing from the process list (e.g. because it exited while the list was being read).
+func newTestProcessTree() (*monitor.ProcessTree, []monitor.Process) {
+	tree := monitor.NewProcessTree()
+	processes := []monitor.Process{
+		{PID: 1, PPID: 0, Name: "init"},
+		{PID: 200, PPID: 100, Name: "bash", Argv: []string{"-bash"}},
+		{PID: 300, PPID: 200, Name: "vim", Argv: []string{"vim", "notes.txt"}},
+		{PID: 301, PPID: 200, Name: "make"},
+		{PID: 400, PPID: 301, Name: "cc"},
+		{PID: 500, PPID: 1, Name: "cron"},
+	}
+	tree.AddProcess(1, 100)
+	for _, p := range processes {
+		tree.AddProcess(p.PPID, p.PID)
+	}
+	return tree, processes
+}
+
+// formatTestTree formats a tree on a single line (e.g. "1(100 200)").
+func formatTestTree(nodes []*treeNode) string {
+	var parts []string
+	for _, node := range nodes {
+		s := fmt.Sprint(node.PID)
+		if len(node.Children) > 0 {
+			s += "(" + formatTestTree(node.Children) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestGetProcessTreeRoots(t *testing.T) {
+	tree, processes := newTestProcessTree()
+	getProcesses := func(pids ...int32) []monitor.Process {
+		var matched []monitor.Process
+		for _, p := range processes {
+			for _, pid := range pids {
+				if p.PID == pid {
+					matched = append(matched, p)
+				}
+			}
+		}
+		return matched
+	}
+	tests := []struct {
+		name     string
+		matched  []monitor.Process
+		pid      int32
+		expected string
+	}{
+		{name: "all", matched: processes, expected: "1(100(200(300 301(400))) 500)"},
+		{name: "ancestors of a match are included", matched: getProcesses(400), expected: "1(100(200(301(400))))"},
+		{name: "ancestors of several matches are only included once", matched: getProcesses(300, 400), expected: "1(100(200(300 301(400))))"},
+		{name: "rooted at pid", matched: processes, pid: 200, expected: "200(300 301(400))"},
+		{name: "ancestors above pid are excluded", matched: getProcesses(400), pid: 200, expected: "200(301(400))"},
+		{name: "pid itself", matched: getProcesses(200), pid: 200, expected: "200"},
+		{name: "matches outside of pid are excluded", matched: getProcesses(500), pid: 200, expected: ""},
+		{name: "nothing matched", expected: ""},
+	}
+	for _, test := range tests {
+		roots := getProcessTreeRoots(tree, processes, test.matched, test.pid)
+		assert.Equal(t, test.expected, formatTestTree(roots), test.name)
+	}
+}
+
+func TestGetProcessTreeRootsLabels(t *testing.T) {
+	tree, processes := newTestProcessTree()
+	roots := getProcessTreeRoots(tree, processes, processes, 0)
+	assert.Len(t, roots, 1)
+	sshd := roots[0].Children[0]
+	assert.Equal(t, "? (PID: 100)", sshd.Label)
+	assert.Nil(t, sshd.Process)
+	bash := sshd.Children[0]
+	assert.Equal(t, "bash (PID: 200) -bash", bash.Label)
+	assert.Equal(t, &processes[1], bash.Process)
+}
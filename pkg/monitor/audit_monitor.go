@@ -4,12 +4,13 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"runtime"
 	"slices"
 	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
-	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -17,29 +18,269 @@ var (
 	EventBufferSize     = 10000
 )
 
+const (
+	// BackendAuto uses the best available tracing backend for the current platform, and falls back to polling.
+	BackendAuto = "auto"
+
+	// BackendPoll polls the process list every ProcessListInterval.
+	BackendPoll = "poll"
+
+	// BackendProcConnector subscribes to the Linux netlink process connector.
+	BackendProcConnector = "proc-connector"
+
+	// BackendAuditd registers with the Linux kernel as the audit daemon and reads records from the NETLINK_AUDIT socket.
+	BackendAuditd = "auditd"
+
+	// BackendAuditLog follows an audit.log file written by auditd.
+	BackendAuditLog = "audit-log"
+)
+
+var DefaultAuditLogPath = "/var/log/audit/audit.log"
+
+type AuditMonitorOptions struct {
+	Backend      string `json:"backend"`
+	AuditLogPath string `json:"audit_log_path,omitempty"`
+
+	// OverflowPolicy determines what happens when Events is full (block, drop-newest, drop-oldest, or spill).
+	OverflowPolicy string `json:"overflow_policy"`
+
+	// SpillPath is the path to the queue used by the spill overflow policy (defaults to a file in a private temporary directory).
+	SpillPath string `json:"spill_path,omitempty"`
+
+	// IncludeHashes hashes the executable of each new process using a pool of HashWorkers.
+	IncludeHashes bool         `json:"include_hashes"`
+	HashOptions   *HashOptions `json:"hash_options,omitempty"`
+	HashWorkers   int          `json:"hash_workers,omitempty"`
+
+	// HashDeadline is how long to wait for an executable to be hashed before sending a process started event without hashes, followed by an enriched event once they're available (0 = don't wait).
+	HashDeadline time.Duration `json:"hash_deadline,omitempty"`
+
+	// TelemetryInterval is how often to emit a telemetry event describing the monitor itself (0 = never).
+	TelemetryInterval time.Duration `json:"telemetry_interval,omitempty"`
+
+	// IncludeUser, IncludeCwd, IncludeSession, and Environment select optional details of each new process (see ProcessOptions).
+	IncludeUser    bool     `json:"include_user,omitempty"`
+	IncludeCwd     bool     `json:"include_cwd,omitempty"`
+	IncludeSession bool     `json:"include_session,omitempty"`
+	Environment    []string `json:"environment,omitempty"`
+
+	// IncludeELF includes the ELF metadata of the executable of each new process (see ProcessOptions).
+	IncludeELF bool `json:"include_elf,omitempty"`
+
+	// IncludeModules includes the shared libraries mapped by each new process, hashing them if IncludeHashes is set (see ProcessOptions).
+	IncludeModules bool `json:"include_modules,omitempty"`
+
+	// ModuleInterval is how often to check for shared libraries which have been loaded by running processes, which are reported by module loaded events (0 = never).
+	ModuleInterval time.Duration `json:"module_interval,omitempty"`
+
+	// IncludeAncestors includes the PID, name, executable, and command line of every ancestor of a process in its started event.
+	IncludeAncestors bool `json:"include_ancestors,omitempty"`
+
+	// Snapshot emits a running event for each matching process once the monitor has started, so that consumers know what was running beforehand.
+	Snapshot bool `json:"snapshot,omitempty"`
+
+	// IncludeHost adds the details of the host to the header of every event (the host ID is always included).
+	IncludeHost bool `json:"include_host,omitempty"`
+
+	// HostInventoryInterval is how often to emit an event describing the host, starting when the monitor starts (0 = never).
+	HostInventoryInterval time.Duration `json:"host_inventory_interval,omitempty"`
+
+	// StatePath is where the processes reported by the monitor are checkpointed every StateInterval, so that the events missed while it wasn't running can be backfilled when it's restarted (disabled if empty).
+	StatePath     string        `json:"state_path,omitempty"`
+	StateInterval time.Duration `json:"state_interval,omitempty"`
+
+	// NetworkInterval is how often to poll for TCP and UDP sockets which have been opened or closed (0 = never).
+	NetworkInterval time.Duration `json:"network_interval,omitempty"`
+
+	// Files reports files which are created, modified, deleted, or renamed in the given directories (disabled if nil).
+	Files *FileMonitorOptions `json:"files,omitempty"`
+
+	// IgnoreSignals stops Run from stopping the monitor on SIGINT, for callers which decide when to stop it themselves.
+	IgnoreSignals bool `json:"ignore_signals,omitempty"`
+}
+
+func GetDefaultAuditMonitorOptions() *AuditMonitorOptions {
+	return &AuditMonitorOptions{
+		Backend:        BackendAuto,
+		AuditLogPath:   DefaultAuditLogPath,
+		OverflowPolicy: OverflowBlock,
+		IncludeHashes:  true,
+		HashOptions:    GetDefaultHashOptions(),
+		HashWorkers:    runtime.NumCPU(),
+		StateInterval:  10 * time.Second,
+	}
+}
+
 type AuditMonitor struct {
 	Events        chan Event
 	ProcessFilter *ProcessFilter
+	Options       *AuditMonitorOptions
+
+	counters  eventCounters
+	spill     *spillQueue
+	hashes    *hashPool
+	processes *processCache
+	state     *stateFile
+	files     *fileWatcher
+	host      *Host
+	startTime time.Time
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// ctx is cancelled when Run returns, and enrichers tracks the goroutines which emit events after the event they enrich (see emitProcessEvent).
+	ctx       context.Context
+	enrichers sync.WaitGroup
 }
 
-func NewAuditMonitor(f *ProcessFilter) (*AuditMonitor, error) {
-	return &AuditMonitor{
+func NewAuditMonitor(f *ProcessFilter, opts *AuditMonitorOptions) (*AuditMonitor, error) {
+	if opts == nil {
+		opts = GetDefaultAuditMonitorOptions()
+	}
+	if f != nil {
+		err := f.Compile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	m := &AuditMonitor{
 		Events:        make(chan Event, EventBufferSize),
 		ProcessFilter: f,
-	}, nil
+		Options:       opts,
+		ready:         make(chan struct{}),
+	}
+	if opts.HashOptions == nil {
+		opts.HashOptions = GetDefaultHashOptions()
+	}
+	err := opts.HashOptions.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeAncestors {
+		m.processes = newProcessCache(ProcessCacheSize)
+	}
+	if opts.IncludeHost {
+		host := GetHost()
+		m.host = &host
+	}
+	if opts.NetworkInterval > 0 && m.processes == nil {
+		m.processes = newProcessCache(ProcessCacheSize)
+	}
+	if opts.StatePath != "" {
+		if opts.StateInterval <= 0 {
+			return nil, errors.New("state interval must be greater than 0")
+		}
+		m.state = newStateFile(opts.StatePath)
+	}
+	if opts.Files != nil {
+		m.files, err = newFileWatcher(opts.Files)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Files.Backend == FileBackendFanotify && m.processes == nil {
+			m.processes = newProcessCache(ProcessCacheSize)
+		}
+	}
+	switch opts.OverflowPolicy {
+	case "":
+		opts.OverflowPolicy = OverflowBlock
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+	case OverflowSpill:
+		q, err := newSpillQueue(opts.SpillPath)
+		if err != nil {
+			return nil, err
+		}
+		m.spill = q
+	default:
+		return nil, errors.Errorf("unsupported overflow policy: %s", opts.OverflowPolicy)
+	}
+	return m, nil
 }
 
 func (m *AuditMonitor) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
+	m.ctx = ctx
+	m.startTime = time.Now()
 
 	var wg sync.WaitGroup
+	if m.Options.IncludeHashes || m.Options.IncludeELF {
+		m.hashes = newHashPool(m.Options.HashWorkers, EventBufferSize, m.Options.HashOptions)
+		defer m.hashes.Close()
+	}
+	if m.spill != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.drainSpillQueue(ctx)
+		}()
+		defer m.spill.Close()
+	}
+	if m.Options.HostInventoryInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.emitHostInventory(ctx)
+		}()
+	}
+	if m.Options.TelemetryInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.emitTelemetry(ctx)
+		}()
+	}
+	if m.Options.ModuleInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.pollModules(ctx)
+		}()
+	}
+	if m.Options.NetworkInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.pollNetworkConnections(ctx)
+		}()
+	}
+	if m.files != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.watchFiles(ctx)
+		}()
+	}
 	wg.Add(1)
-
 	go m.goReadEvents(ctx, cancel, &wg)
 
+	if m.state != nil {
+		previous, err := readStateFile(m.Options.StatePath)
+		if err != nil {
+			log.Warnf("Failed to read state, not backfilling events: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.saveState(ctx, previous)
+		}()
+	}
+	if m.Options.Snapshot {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-m.Ready():
+				m.emitSnapshot()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
 	// Handle signals.
 	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel, os.Interrupt)
+	if !m.Options.IgnoreSignals {
+		signal.Notify(signalChannel, os.Interrupt)
+		defer signal.Stop(signalChannel)
+	}
 
 	log.Info("Waiting for context cancellation or SIGINT...")
 	select {
@@ -51,13 +292,37 @@ func (m *AuditMonitor) Run(ctx context.Context) error {
 		cancel()
 	}
 	wg.Wait()
+	m.enrichers.Wait()
 	return nil
 }
 
+// runContext returns the context of the running monitor, which is cancelled once it's stopped.
+func (m *AuditMonitor) runContext() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// Ready returns a channel which is closed once the monitor has started reading events (i.e. processes started from then on will be reported).
+func (m *AuditMonitor) Ready() <-chan struct{} {
+	return m.ready
+}
+
+func (m *AuditMonitor) setReady() {
+	m.readyOnce.Do(func() {
+		close(m.ready)
+	})
+}
+
 func (m *AuditMonitor) goReadEvents(ctx context.Context, cancel context.CancelFunc, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	err := traceAuditEvents(ctx, m.Events)
+	if m.Options.Backend == BackendPoll {
+		m.pollAuditEvents(ctx, cancel, wg)
+		return
+	}
+	err := traceAuditEvents(ctx, m)
 	if err != nil {
 		log.Warnf("Failed to trace audit events: %s", err)
 		log.Info("Falling back to polling audit events")
@@ -66,80 +331,417 @@ func (m *AuditMonitor) goReadEvents(ctx context.Context, cancel context.CancelFu
 }
 
 func (m *AuditMonitor) pollAuditEvents(ctx context.Context, cancel context.CancelFunc, wg *sync.WaitGroup) {
-	seen, err := lru.New(10000)
-	if err != nil {
-		log.Errorf("Failed to create LRU cache: %v", err)
-		return
-	}
-	opts := &ProcessOptions{
-		IncludeHashes: false,
-	}
 	ids, err := listProcessIdentities()
 	if err != nil {
 		log.Errorf("Failed to list processes: %v", err)
 		return
 	}
-	for _, id := range ids {
-		seen.Add(id.Hash(), id)
-	}
+	p := newProcessPoller(m, ids, time.Now())
 
 	ticker := time.NewTicker(ProcessListInterval)
 	defer ticker.Stop()
-
-	var tree *ProcessTree
-	f := m.ProcessFilter
+	m.setReady()
 
 	for {
 		select {
 		case <-ticker.C:
+			pollTime := time.Now()
 			ids, err := listProcessIdentities()
 			if err != nil {
 				log.Fatalf("Failed to list processes: %v", err)
 				return
 			}
+			p.poll(m, ids, pollTime)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processPoller reports the processes which have started or stopped between successive listings of the running processes.
+type processPoller struct {
+	// previous are the processes seen during the last poll, and matched the subset of those which matched the filter (i.e. the processes we'll report as stopped).
+	previous         map[processKey]ProcessIdentity
+	matched          map[processKey]*ProcessStopEventData
+	previousPollTime time.Time
+	tree             *ProcessTree
+}
+
+func newProcessPoller(m *AuditMonitor, ids []ProcessIdentity, pollTime time.Time) *processPoller {
+	p := &processPoller{
+		previous:         make(map[processKey]ProcessIdentity, len(ids)),
+		matched:          make(map[processKey]*ProcessStopEventData),
+		previousPollTime: pollTime,
+		tree:             NewProcessTreeFromProcessIdentities(ids),
+	}
+	getIdentity := getProcessIdentitiesByPid(ids)
+	for _, id := range ids {
+		p.previous[id.key()] = id
+		if m.matchesRunningProcess(id, p.tree) {
+			p.matched[id.key()] = newProcessStopEventData(id, getIdentity)
+		}
+	}
+	return p
+}
+
+// poll emits events for the processes which have started or stopped since the last poll.
+func (p *processPoller) poll(m *AuditMonitor, ids []ProcessIdentity, pollTime time.Time) {
+	opts := m.getNewProcessOptions()
+	f := m.ProcessFilter
+
+	current := make(map[processKey]ProcessIdentity, len(ids))
+	var started, exited []ProcessIdentity
+	for _, id := range ids {
+		k := id.key()
+		current[k] = id
+		if _, ok := p.previous[k]; !ok {
+			started = append(started, id)
+		}
+	}
+	for k, id := range p.previous {
+		if _, ok := current[k]; !ok {
+			exited = append(exited, id)
+		}
+	}
+	p.tree.Update(started, exited)
+
+	getIdentity := getProcessIdentitiesByPid(ids)
+	for _, id := range started {
+		k := id.key()
+		m.forgetProcess(id.PID)
+		if !f.MatchesPID(id.PID, p.tree) {
+			continue
+		}
+
+		process, err := GetProcess(id.PID, opts)
+		if err != nil {
+			log.Warnf("A new process was detected, but we weren't fast enough to get its details: %v (PID: %d, PPID: %d)", err, id.PID, id.PPID)
+			process = &Process{
+				PID:        id.PID,
+				PPID:       id.PPID,
+				CreateTime: id.CreateTime(),
+			}
+		}
+		// The process may have been replaced between listing processes and reading its details, so we trust the snapshot.
+		process.GUID = id.GUID()
+		if parent, err := getIdentity(id.PPID); err == nil {
+			process.ParentGUID = parent.GUID()
+		}
+		m.cacheProcess(process)
+		if !m.matchesProcess(process) {
+			continue
+		}
+		m.setAncestors(process, p.tree)
+		p.matched[k] = newProcessStopEventData(id, getIdentity)
+
+		details := ProcessStartEventData{
+			Process: *process,
+		}
+		log.Infof("Process started (PID: %d, PPID: %d, name: %s)", process.PID, process.PPID, process.Name)
+		m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeStarted, details))
+	}
 
-			if f != nil && len(f.AncestorPIDs) > 0 {
-				tree, err = GetProcessTree()
-				if err != nil {
-					log.Fatalf("Failed to get process tree: %v", err)
-				}
+	// Processes which have disappeared since the last poll exited somewhere in between.
+	exitTime := p.previousPollTime.Add(pollTime.Sub(p.previousPollTime) / 2)
+	for _, id := range exited {
+		k := id.key()
+		details, ok := p.matched[k]
+		if !ok {
+			continue
+		}
+		delete(p.matched, k)
+
+		details.ExitTime = &exitTime
+		details.calculateLifetime()
+		log.Infof("Process stopped (PID: %d, PPID: %d)", id.PID, id.PPID)
+		m.emit(NewEvent(ObjectTypeProcess, EventTypeStopped, *details))
+	}
+	p.previous = current
+	p.previousPollTime = pollTime
+}
+
+// emitProcessEvent emits a process event, hashing the executable and modules of a started process and parsing its executable (asynchronously) if required.
+func (m *AuditMonitor) emitProcessEvent(e Event) {
+	data, ok := e.Data.(ProcessStartEventData)
+	if !ok || m.hashes == nil {
+		m.emit(e)
+		return
+	}
+	h := m.submitProcessFiles(&data)
+	if !h.empty() && m.Options.HashDeadline > 0 {
+		timer := time.NewTimer(m.Options.HashDeadline)
+		h.wait(context.Background(), timer.C, &data)
+		timer.Stop()
+	}
+	e.Data = data
+	m.emit(e)
+	if h.empty() {
+		return
+	}
+
+	enriched := ProcessEnrichEventData{
+		GUID: data.GUID,
+		PID:  data.PID,
+	}
+	exe := data.Executable
+	if h.hasModules() {
+		// The modules are copied since the started event has already been emitted.
+		data.Modules = slices.Clone(data.Modules)
+		enriched.Modules = data.Modules
+	}
+	ctx := m.runContext()
+	m.enrichers.Add(1)
+	go func() {
+		defer m.enrichers.Done()
+		hashed, ok := h.wait(ctx, nil, &data)
+		if !ok || hashed == 0 {
+			return
+		}
+		if data.Executable != exe {
+			enriched.Executable = data.Executable
+		}
+		m.emitContext(ctx, NewEvent(ObjectTypeProcess, EventTypeEnriched, enriched))
+	}()
+}
+
+// pendingHashes are the files of a started process which are being hashed by the hash pool.
+type pendingHashes struct {
+	exe <-chan hashResult
+
+	// modules are indexed in the same order as the modules of the process (nil if a module isn't being hashed).
+	modules []<-chan hashResult
+}
+
+// submitProcessFiles hashes the executable and modules of a process using the hash cache, submitting any files which haven't been hashed yet to the hash pool.
+func (m *AuditMonitor) submitProcessFiles(data *ProcessStartEventData) *pendingHashes {
+	var ok bool
+	h := &pendingHashes{}
+	opts := m.Options.HashOptions
+	if exe := data.Executable; exe != nil {
+		var r hashResult
+		hash := m.Options.IncludeHashes && exe.Hashes == nil
+		if hash {
+			r.hashes, ok = getCachedFileHashes(exe.Path, opts)
+			hash = !ok
+		}
+		parseELF := m.Options.IncludeELF && exe.ELF == nil
+		if parseELF {
+			r.elf, ok = getCachedELF(exe.Path, opts)
+			parseELF = !ok
+		}
+		if r.hashes != nil || r.elf != nil {
+			data.Executable = exe.withResult(r)
+		}
+		if hash || parseELF {
+			ch, err := m.hashes.SubmitFile(exe.Path, hash, parseELF)
+			if err != nil {
+				log.Warnf("Not hashing executable: %v (path: %s)", err, exe.Path)
+			} else {
+				h.exe = ch
+			}
+		}
+	}
+	if !m.Options.IncludeHashes || len(data.Modules) == 0 {
+		return h
+	}
+	data.Modules = slices.Clone(data.Modules)
+	h.modules = make([]<-chan hashResult, len(data.Modules))
+	for i, module := range data.Modules {
+		path := module.hashPath()
+		if path == "" || module.Hashes != nil {
+			continue
+		}
+		if hashes, ok := getCachedFileHashes(path, opts); ok {
+			data.Modules[i].Hashes = hashes
+			continue
+		}
+		ch, err := m.hashes.Submit(path)
+		if err != nil {
+			log.Debugf("Not hashing module: %v (path: %s)", err, module.Path)
+			continue
+		}
+		h.modules[i] = ch
+	}
+	return h
+}
+
+func (h *pendingHashes) hasModules() bool {
+	for _, ch := range h.modules {
+		if ch != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *pendingHashes) empty() bool {
+	return h.exe == nil && !h.hasModules()
+}
+
+// wait adds the hashes of the files to the process as they're hashed, returning the number of files which were hashed and false if the timeout expires or the context is cancelled first (a nil timeout never expires).
+func (h *pendingHashes) wait(ctx context.Context, timeout <-chan time.Time, data *ProcessStartEventData) (int, bool) {
+	hashed := 0
+	if h.exe != nil {
+		select {
+		case r := <-h.exe:
+			h.exe = nil
+			if r.err != nil {
+				log.Debugf("Failed to hash executable: %v (path: %s)", r.err, data.Executable.Path)
+			}
+			if r.hashes != nil || r.elf != nil {
+				data.Executable = data.Executable.withResult(r)
+				hashed++
 			}
-			for _, id := range ids {
-				if f != nil {
-					if f.PIDs != nil && !slices.Contains(f.PIDs, id.PID) {
-						continue
-					}
-					if len(f.AncestorPIDs) > 0 {
-						if !tree.IsDescendantOfAny(id.PID, f.AncestorPIDs) {
-							continue
-						}
-					}
-				}
-
-				h := id.Hash()
-				_, ok := seen.Get(h)
-				if !ok {
-					seen.Add(h, id)
-
-					var process *Process
-					process, err = GetProcess(id.PID, opts)
-					if err != nil {
-						log.Warnf("A new process was detected, but we weren't fast enough to get its details: %v (PID: %d, PPID: %d)", err, id.PID, id.PPID)
-						process = &Process{
-							PID:  id.PID,
-							PPID: id.PPID,
-						}
-					}
-					details := ProcessStartEventData{
-						Process: *process,
-					}
-					log.Infof("Process started (PID: %d, PPID: %d, name: %s)", process.PID, process.PPID, process.Name)
-					m.Events <- NewEvent(ObjectTypeProcess, EventTypeStarted, details)
-				}
+		case <-timeout:
+			return hashed, false
+		case <-ctx.Done():
+			return hashed, false
+		}
+	}
+	for i, ch := range h.modules {
+		if ch == nil {
+			continue
+		}
+		select {
+		case r := <-ch:
+			h.modules[i] = nil
+			if r.err != nil {
+				log.Debugf("Failed to hash module: %v (path: %s)", r.err, data.Modules[i].Path)
+			} else {
+				data.Modules[i].Hashes = r.hashes
+				hashed++
 			}
+		case <-timeout:
+			return hashed, false
+		case <-ctx.Done():
+			return hashed, false
+		}
+	}
+	return hashed, true
+}
+
+func (m *AuditMonitor) emitHostInventory(ctx context.Context) {
+	m.emit(NewEvent(ObjectTypeHost, EventTypeInventory, GetHostInventory()))
 
+	ticker := time.NewTicker(m.Options.HostInventoryInterval)
+	defer ticker.Stop()
+	for {
+		select {
 		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			m.emit(NewEvent(ObjectTypeHost, EventTypeInventory, GetHostInventory()))
+		}
+	}
+}
+
+func (m *AuditMonitor) emitTelemetry(ctx context.Context) {
+	ticker := time.NewTicker(m.Options.TelemetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.emit(NewEvent(ObjectTypeMonitor, EventTypeTelemetry, m.GetTelemetry()))
+		}
+	}
+}
+
+// GetTelemetry returns the event counters and queue lengths of the monitor.
+func (m *AuditMonitor) GetTelemetry() MonitorTelemetryEventData {
+	d := MonitorTelemetryEventData{
+		Backend:          m.Options.Backend,
+		OverflowPolicy:   m.Options.OverflowPolicy,
+		Events:           m.counters.emitted.Load(),
+		DroppedNewest:    m.counters.droppedNewest.Load(),
+		DroppedOldest:    m.counters.droppedOldest.Load(),
+		Spilled:          m.counters.spilled.Load(),
+		KernelOverflows:  m.counters.kernelOverflows.Load(),
+		QueueLength:      len(m.Events),
+		QueueCapacity:    cap(m.Events),
+		SpillQueueLength: m.spill.Len(),
+	}
+	if !m.startTime.IsZero() {
+		d.Uptime = time.Since(m.startTime).Seconds()
+	}
+	return d
+}
+
+// getNewProcessOptions returns the options used to read the details of new processes, whose executables are parsed by the hash pool (see emitProcessEvent) rather than while the event is being read.
+func (m *AuditMonitor) getNewProcessOptions() *ProcessOptions {
+	opts := m.getProcessOptions()
+	if m.hashes != nil {
+		opts.IncludeELF = false
+	}
+	return opts
+}
+
+func (m *AuditMonitor) getProcessOptions() *ProcessOptions {
+	return &ProcessOptions{
+		IncludeHashes:  m.ProcessFilter.needsHashes(),
+		HashOptions:    m.Options.HashOptions,
+		IncludeUser:    m.Options.IncludeUser,
+		IncludeCwd:     m.Options.IncludeCwd,
+		IncludeSession: m.Options.IncludeSession,
+		Environment:    m.Options.Environment,
+		IncludeModules: m.Options.IncludeModules,
+		IncludeELF:     m.Options.IncludeELF,
+	}
+}
+
+// matchesProcess evaluates the include and exclude rules of the filter against a process, looking up its parent if required.
+func (m *AuditMonitor) matchesProcess(p *Process) bool {
+	f := m.ProcessFilter
+	if !f.hasRules() {
+		return true
+	}
+	var parent *Process
+	if f.needsParent() {
+		name, err := getProcessName(p.PPID)
+		if err == nil {
+			parent = &Process{
+				PID:  p.PPID,
+				Name: name,
+			}
+		}
+	}
+	return f.MatchesProcess(p, parent)
+}
+
+// matchesRunningProcess evaluates the filter against a running process, reading its details if the filter has any rules.
+func (m *AuditMonitor) matchesRunningProcess(id ProcessIdentity, tree *ProcessTree) bool {
+	f := m.ProcessFilter
+	if !f.MatchesPID(id.PID, tree) {
+		return false
+	}
+	if !f.hasRules() {
+		return true
+	}
+	process, err := GetProcess(id.PID, m.getProcessOptions())
+	if err != nil {
+		return false
+	}
+	return m.matchesProcess(process)
+}
+
+// matchesNewProcess evaluates the filter against a process which was reported by an event source, hashing its executable if required.
+func (m *AuditMonitor) matchesNewProcess(p *Process) bool {
+	f := m.ProcessFilter
+	var tree *ProcessTree
+	if f != nil && len(f.AncestorPIDs) > 0 {
+		tree = GetAncestryTree(p.PID)
+	}
+	if !f.MatchesPID(p.PID, tree) {
+		return false
+	}
+	if f.needsHashes() && p.Executable != nil && p.Executable.Hashes == nil {
+		hashes, err := GetCachedFileHashes(p.Executable.Path, m.Options.HashOptions)
+		if err != nil {
+			log.Debugf("Failed to hash executable: %v (path: %s)", err, p.Executable.Path)
 		}
+		p.Executable.Hashes = hashes
 	}
+	return m.matchesProcess(p)
 }
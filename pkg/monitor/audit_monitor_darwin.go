@@ -5,6 +5,6 @@ import (
 	"errors"
 )
 
-func traceAuditEvents(ctx context.Context, ch chan Event) error {
+func traceAuditEvents(ctx context.Context, m *AuditMonitor) error {
 	return errors.New("not implemented")
 }
@@ -2,9 +2,49 @@ package monitor
 
 import (
 	"context"
-	"errors"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
 )
 
-func traceAuditEvents(ctx context.Context, ch chan Event) error {
-	return errors.New("not implemented")
+func traceAuditEvents(ctx context.Context, m *AuditMonitor) error {
+	var err error
+	switch m.Options.Backend {
+	case BackendAuto, BackendProcConnector:
+		err = traceProcConnectorEvents(ctx, m)
+	case BackendAuditd:
+		err = traceAuditdEvents(ctx, m)
+	case BackendAuditLog:
+		log.Infof("Reading audit records from %s...", m.Options.AuditLogPath)
+		err = tailAuditLog(ctx, m.Options.AuditLogPath, m)
+	default:
+		return errors.Errorf("unsupported backend: %s", m.Options.Backend)
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("Stopped reading events")
+	return nil
+}
+
+func traceProcConnectorEvents(ctx context.Context, m *AuditMonitor) error {
+	c, err := newProcConnector()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	log.Infof("Reading process events from the netlink process connector...")
+	return c.Run(ctx, m)
+}
+
+func traceAuditdEvents(ctx context.Context, m *AuditMonitor) error {
+	c, err := newAuditClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	log.Infof("Reading audit records from the netlink audit socket...")
+	return c.Run(ctx, m)
 }
@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessPoller(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	init := ProcessIdentity{PID: 1, PPID: 0, StartTime: 100}
+	exited := ProcessIdentity{PID: 1000001, PPID: 1, StartTime: 200}
+	reused := ProcessIdentity{PID: 1000002, PPID: 1, StartTime: 300}
+	start := time.Now()
+	p := newProcessPoller(m, []ProcessIdentity{init, exited, reused}, start)
+
+	// A process which has disappeared is reported as stopped halfway between the polls, and a PID which has been reused by a new process is reported as both.
+	replacement := ProcessIdentity{PID: 1000002, PPID: 1, StartTime: 400}
+	started := ProcessIdentity{PID: 1000003, PPID: 1000002, StartTime: 500}
+	p.poll(m, []ProcessIdentity{init, replacement, started}, start.Add(2*time.Second))
+	events := readEvents(m)
+	assert.Len(t, events, 4)
+
+	startedGUIDs := make(map[string]ProcessStartEventData)
+	stopped := make(map[int32]ProcessStopEventData)
+	for _, e := range events {
+		switch e.Header.EventType {
+		case EventTypeStarted:
+			data := e.Data.(ProcessStartEventData)
+			startedGUIDs[data.GUID] = data
+		case EventTypeStopped:
+			data := e.Data.(ProcessStopEventData)
+			stopped[data.PID] = data
+		}
+	}
+	assert.Contains(t, startedGUIDs, replacement.GUID())
+	assert.Equal(t, replacement.GUID(), startedGUIDs[started.GUID()].ParentGUID)
+	assert.Len(t, stopped, 2)
+
+	data := stopped[exited.PID]
+	assert.Equal(t, exited.GUID(), data.GUID)
+	assert.Equal(t, init.GUID(), data.ParentGUID)
+	assert.Equal(t, int32(1), *data.PPID)
+	assert.Equal(t, exited.CreateTime(), data.CreateTime)
+	assert.Equal(t, start.Add(time.Second), *data.ExitTime)
+	assert.Equal(t, data.ExitTime.Sub(*data.CreateTime).Seconds(), *data.Lifetime)
+	assert.Nil(t, data.ExitCode)
+	assert.Equal(t, reused.GUID(), stopped[reused.PID].GUID)
+
+	// Nothing is reported if nothing has changed.
+	p.poll(m, []ProcessIdentity{init, replacement, started}, start.Add(3*time.Second))
+	assert.Empty(t, readEvents(m))
+}
+
+func TestProcessPollerFilter(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.ProcessFilter = &ProcessFilter{AncestorPIDs: []int32{1000001}}
+	init := ProcessIdentity{PID: 1, PPID: 0, StartTime: 100}
+	ancestor := ProcessIdentity{PID: 1000001, PPID: 1, StartTime: 200}
+	unrelated := ProcessIdentity{PID: 1000002, PPID: 1, StartTime: 300}
+	start := time.Now()
+	p := newProcessPoller(m, []ProcessIdentity{init, ancestor, unrelated}, start)
+
+	// Only the descendants of the ancestor are reported.
+	child := ProcessIdentity{PID: 1000003, PPID: 1000001, StartTime: 400}
+	other := ProcessIdentity{PID: 1000004, PPID: 1000002, StartTime: 500}
+	p.poll(m, []ProcessIdentity{init, ancestor, unrelated, child, other}, start.Add(time.Second))
+	events := readEvents(m)
+	assert.Len(t, events, 1)
+	assert.Equal(t, child.PID, events[0].Data.(ProcessStartEventData).PID)
+
+	p.poll(m, []ProcessIdentity{init}, start.Add(2*time.Second))
+	events = readEvents(m)
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventType(EventTypeStopped), events[0].Header.EventType)
+	assert.Equal(t, child.PID, events[0].Data.(ProcessStopEventData).PID)
+}
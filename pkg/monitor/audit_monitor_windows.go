@@ -52,7 +52,7 @@ func enableProvider(s *etw.RealTimeSession, providerGuid string, matchAnyKeyword
 	return nil
 }
 
-func traceAuditEvents(ctx context.Context, ch chan Event) error {
+func traceAuditEvents(ctx context.Context, m *AuditMonitor) error {
 	s, err := newSession()
 	if err != nil {
 		return err
@@ -76,7 +76,7 @@ func traceAuditEvents(ctx context.Context, ch chan Event) error {
 				log.Errorf("Failed to parse event: %v", err)
 				continue
 			}
-			ch <- *evt
+			m.emitProcessEvent(*evt)
 		}
 	}()
 
@@ -86,6 +86,7 @@ func traceAuditEvents(ctx context.Context, ch chan Event) error {
 		return errors.Wrap(err, "failed to start ETW consumer")
 	}
 	log.Infof("Reading events...")
+	m.setReady()
 	<-ctx.Done()
 	log.Infof("Stopped reading events")
 	return nil
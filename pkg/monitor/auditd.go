@@ -0,0 +1,578 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+// Record types from linux/audit.h.
+const (
+	auditRecordTypeSyscall   = "SYSCALL"
+	auditRecordTypePath      = "PATH"
+	auditRecordTypeCwd       = "CWD"
+	auditRecordTypeExecve    = "EXECVE"
+	auditRecordTypeEOE       = "EOE"
+	auditRecordTypeProctitle = "PROCTITLE"
+)
+
+var auditRecordTypes = map[uint16]string{
+	1300: auditRecordTypeSyscall,
+	1302: auditRecordTypePath,
+	1307: auditRecordTypeCwd,
+	1309: auditRecordTypeExecve,
+	1320: auditRecordTypeEOE,
+	1327: auditRecordTypeProctitle,
+}
+
+var (
+	// AuditEventTimeout is how long we wait for the remaining records of an event which wasn't terminated by an EOE record.
+	AuditEventTimeout = 2 * time.Second
+
+	AuditLogPollInterval = 250 * time.Millisecond
+)
+
+// auditMaxArgc is the largest argument count which is accepted from an EXECVE record, which is well above the number of arguments that fit in the default ARG_MAX.
+const auditMaxArgc = 1 << 20
+
+type auditRecord struct {
+	Type   string
+	Time   time.Time
+	Serial uint64
+	Fields map[string]auditField
+}
+
+type auditField struct {
+	Value string
+
+	// Quoted is false for values which may be hex encoded.
+	Quoted bool
+}
+
+type auditEvent struct {
+	Serial  uint64
+	Time    time.Time
+	Records []*auditRecord
+}
+
+func (e auditEvent) getRecords(recordType string) []*auditRecord {
+	var records []*auditRecord
+	for _, r := range e.Records {
+		if r.Type == recordType {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func (e auditEvent) getRecord(recordType string) *auditRecord {
+	for _, r := range e.Records {
+		if r.Type == recordType {
+			return r
+		}
+	}
+	return nil
+}
+
+// ParseAuditLog reads an audit.log file (as written by auditd) and returns a process started event for every successful execve.
+func ParseAuditLog(rd io.Reader) ([]Event, error) {
+	var completed []*auditEvent
+	a := newAuditAssembler()
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r, err := parseAuditLogLine(scanner.Text())
+		if err != nil {
+			log.Debugf("Skipping audit record: %v", err)
+			continue
+		}
+		completed = append(completed, a.Add(r)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	completed = append(completed, a.FlushAll()...)
+	sortAuditEvents(completed)
+
+	var events []Event
+	for _, e := range completed {
+		process := e.toProcess()
+		if process != nil {
+			events = append(events, e.newProcessEvent(process))
+		}
+	}
+	return events, nil
+}
+
+func ParseAuditLogFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAuditLog(f)
+}
+
+// tailAuditLog follows an audit.log file from its current end, reopening it when auditd rotates it.
+func tailAuditLog(ctx context.Context, path string, m *AuditMonitor) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open audit log")
+	}
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to seek to the end of the audit log")
+	}
+	r := newAuditLogReader(f)
+	defer r.Close()
+
+	a := newAuditAssembler()
+	m.setReady()
+
+	ticker := time.NewTicker(AuditLogPollInterval)
+	defer ticker.Stop()
+
+	for {
+		records, err := r.Read()
+		for _, record := range records {
+			sendAuditProcessEvents(m, a.Add(record))
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		sendAuditProcessEvents(m, a.Flush(time.Now().Add(-AuditEventTimeout)))
+
+		records, err = r.Reopen(path)
+		for _, record := range records {
+			sendAuditProcessEvents(m, a.Add(record))
+		}
+		if err != nil {
+			log.Warnf("Failed to reopen audit log: %v", err)
+		}
+	}
+}
+
+// auditLogReader reads the records which are appended to an audit.log file.
+type auditLogReader struct {
+	f       *os.File
+	reader  *bufio.Reader
+	partial string
+}
+
+func newAuditLogReader(f *os.File) *auditLogReader {
+	return &auditLogReader{
+		f:      f,
+		reader: bufio.NewReader(f),
+	}
+}
+
+// Read returns the records which have been completely written since the last read.
+func (r *auditLogReader) Read() ([]*auditRecord, error) {
+	var records []*auditRecord
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err == io.EOF {
+			r.partial += line
+			return records, nil
+		} else if err != nil {
+			return records, errors.Wrap(err, "failed to read audit log")
+		}
+		record, err := parseAuditLogLine(r.partial + line)
+		r.partial = ""
+		if err != nil {
+			log.Debugf("Skipping audit record: %v", err)
+			continue
+		}
+		records = append(records, record)
+	}
+}
+
+// Reopen switches to the file at the given path if the file being read has been rotated, returning the records which were written to the old file before it was rotated.
+func (r *auditLogReader) Reopen(path string) ([]*auditRecord, error) {
+	current, err := os.Stat(path)
+	if err != nil {
+		// auditd hasn't created the new file yet.
+		return nil, nil
+	}
+	previous, err := r.f.Stat()
+	if err != nil || os.SameFile(current, previous) {
+		return nil, nil
+	}
+	log.Infof("Audit log rotated, reopening %s", path)
+	rotated, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.Read()
+	if err != nil {
+		log.Warnf("Failed to read the end of the rotated audit log: %v", err)
+	}
+	if r.partial != "" {
+		// auditd won't finish writing a partial line to the old file.
+		record, err := parseAuditLogLine(r.partial)
+		if err == nil {
+			records = append(records, record)
+		}
+	}
+	r.f.Close()
+	r.f = rotated
+	r.reader.Reset(rotated)
+	r.partial = ""
+	return records, nil
+}
+
+func (r *auditLogReader) Close() error {
+	return r.f.Close()
+}
+
+// sendAuditProcessEvents sends process started events for the given audit events, which are assumed to be recent enough for the processes to still be running.
+func sendAuditProcessEvents(m *AuditMonitor, completed []*auditEvent) {
+	for _, e := range completed {
+		process := e.toProcess()
+		if process == nil {
+			continue
+		}
+		setProcessContainer(process)
+		setProcessDetails(process, m.getNewProcessOptions())
+
+		// The GUIDs are set before the process is cached so that they're included when it's described as an ancestor.
+		setProcessGUIDs(process, getProcessIdentity)
+		m.cacheProcess(process)
+		if !m.matchesNewProcess(process) {
+			continue
+		}
+		if m.Options.IncludeAncestors {
+			// The process may have already exited, so we start from its parent.
+			tree := GetAncestryTree(process.PPID)
+			tree.AddProcess(process.PPID, process.PID)
+			m.setAncestors(process, tree)
+		}
+		m.emitProcessEvent(e.newProcessEvent(process))
+	}
+}
+
+// parseAuditLogLine parses a record written to audit.log, e.g. `type=CWD msg=audit(1707235200.123:456): cwd="/root"`.
+func parseAuditLogLine(line string) (*auditRecord, error) {
+	line = strings.TrimRight(line, "\r\n")
+
+	// Records written with log_format=ENRICHED have interpreted fields appended after a group separator.
+	if i := strings.IndexByte(line, 0x1d); i >= 0 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(line, "type=") {
+		return nil, errors.New("missing record type")
+	}
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return nil, errors.New("missing record body")
+	}
+	recordType := line[len("type="):i]
+	body := strings.TrimPrefix(strings.TrimLeft(line[i:], " "), "msg=")
+	return parseAuditRecord(recordType, body)
+}
+
+// parseAuditRecord parses the body of an audit record, e.g. `audit(1707235200.123:456): cwd="/root"`.
+func parseAuditRecord(recordType, body string) (*auditRecord, error) {
+	if !strings.HasPrefix(body, "audit(") {
+		return nil, errors.New("missing audit header")
+	}
+	end := strings.Index(body, "):")
+	if end < 0 {
+		return nil, errors.New("malformed audit header")
+	}
+	timestamp, serial, ok := strings.Cut(body[len("audit("):end], ":")
+	if !ok {
+		return nil, errors.New("malformed audit header")
+	}
+	sec, frac, _ := strings.Cut(timestamp, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed audit timestamp")
+	}
+	var ms int64
+	if frac != "" {
+		ms, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed audit timestamp")
+		}
+	}
+	n, err := strconv.ParseUint(serial, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed audit serial")
+	}
+	return &auditRecord{
+		Type:   recordType,
+		Time:   time.Unix(s, ms*int64(time.Millisecond)),
+		Serial: n,
+		Fields: parseAuditFields(body[end+2:]),
+	}, nil
+}
+
+// parseAuditFields splits a list of key=value pairs where values may be wrapped in single or double quotes.
+func parseAuditFields(s string) map[string]auditField {
+	fields := make(map[string]auditField)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			break
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value auditField
+		if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+			value.Quoted = true
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				value.Value, s = s[1:], ""
+			} else {
+				value.Value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				value.Value, s = s, ""
+			} else {
+				value.Value, s = s[:end], s[end:]
+			}
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// getString returns the value of a field that holds an untrusted string, which auditd hex encodes if it contains special characters.
+func (r auditRecord) getString(key string) (string, bool) {
+	v, ok := r.Fields[key]
+	if !ok {
+		return "", false
+	}
+	if v.Quoted {
+		return v.Value, true
+	}
+	if v.Value == "(null)" {
+		return "", false
+	}
+	b, err := hex.DecodeString(v.Value)
+	if err != nil {
+		return v.Value, true
+	}
+	return string(b), true
+}
+
+// getValue returns the value of a field that holds a number or keyword.
+func (r auditRecord) getValue(key string) (string, bool) {
+	v, ok := r.Fields[key]
+	return v.Value, ok
+}
+
+func (r auditRecord) getInt(key string) (int64, bool) {
+	v, ok := r.getValue(key)
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	return i, err == nil
+}
+
+// auditAssembler groups records which belong to the same event by serial number.
+type auditAssembler struct {
+	pending map[uint64]*auditEvent
+	latest  time.Time
+}
+
+func newAuditAssembler() *auditAssembler {
+	return &auditAssembler{
+		pending: make(map[uint64]*auditEvent),
+	}
+}
+
+// Add adds a record and returns any events which are known to be complete.
+func (a *auditAssembler) Add(r *auditRecord) []*auditEvent {
+	if r.Time.After(a.latest) {
+		a.latest = r.Time
+	}
+	e, ok := a.pending[r.Serial]
+	if !ok {
+		e = &auditEvent{
+			Serial: r.Serial,
+			Time:   r.Time,
+		}
+		a.pending[r.Serial] = e
+	}
+	if r.Type == auditRecordTypeEOE {
+		delete(a.pending, r.Serial)
+		completed := a.Flush(a.latest.Add(-AuditEventTimeout))
+		return append([]*auditEvent{e}, completed...)
+	}
+	e.Records = append(e.Records, r)
+	return a.Flush(a.latest.Add(-AuditEventTimeout))
+}
+
+// Flush returns the pending events which started before the given time.
+func (a *auditAssembler) Flush(before time.Time) []*auditEvent {
+	var completed []*auditEvent
+	for serial, e := range a.pending {
+		if e.Time.Before(before) {
+			completed = append(completed, e)
+			delete(a.pending, serial)
+		}
+	}
+	sortAuditEvents(completed)
+	return completed
+}
+
+func (a *auditAssembler) FlushAll() []*auditEvent {
+	var completed []*auditEvent
+	for _, e := range a.pending {
+		completed = append(completed, e)
+	}
+	a.pending = make(map[uint64]*auditEvent)
+	sortAuditEvents(completed)
+	return completed
+}
+
+func sortAuditEvents(events []*auditEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Serial < events[j].Serial
+	})
+}
+
+// toProcess returns the process created by a successful execve, or nil if the event isn't a successful execve.
+func (e auditEvent) toProcess() *Process {
+	syscallRecord := e.getRecord(auditRecordTypeSyscall)
+	execveRecords := e.getRecords(auditRecordTypeExecve)
+	if syscallRecord == nil || len(execveRecords) == 0 {
+		return nil
+	}
+	if success, _ := syscallRecord.getValue("success"); success != "yes" {
+		return nil
+	}
+	pid, _ := syscallRecord.getInt("pid")
+	ppid, _ := syscallRecord.getInt("ppid")
+	// The create time of the process is when it was forked rather than the time of the execve, so it's only known if the process is still running (see setProcessGUIDs).
+	process := &Process{
+		PID:  int32(pid),
+		PPID: int32(ppid),
+	}
+	process.Name, _ = syscallRecord.getString("comm")
+
+	process.Argv = getAuditArgv(execveRecords)
+	if len(process.Argv) == 0 {
+		if r := e.getRecord(auditRecordTypeProctitle); r != nil {
+			title, _ := r.getString("proctitle")
+			process.Argv = strings.Split(strings.TrimRight(title, "\x00"), "\x00")
+		}
+	}
+	process.Argc = len(process.Argv)
+	process.CommandLine = strings.Join(process.Argv, " ")
+
+	if r := e.getRecord(auditRecordTypeCwd); r != nil {
+		process.Cwd, _ = r.getString("cwd")
+	}
+
+	exe, ok := syscallRecord.getString("exe")
+	if !ok {
+		// Fall back to the path of the executable as it was passed to execve.
+		for _, r := range e.getRecords(auditRecordTypePath) {
+			if item, _ := r.getValue("item"); item == "0" {
+				exe, ok = r.getString("name")
+				if ok && !filepath.IsAbs(exe) && process.Cwd != "" {
+					exe = filepath.Join(process.Cwd, exe)
+				}
+			}
+		}
+	}
+	if ok && exe != "" {
+		executable := NewFile(exe)
+		process.Executable = &executable
+	}
+	if creds := getAuditCredentials(syscallRecord); creds != nil {
+		setProcessCredentials(process, creds)
+	}
+	return process
+}
+
+// getAuditCredentials returns the user and group IDs of the process which made a syscall, or nil if any of them are missing.
+func getAuditCredentials(r *auditRecord) *ProcessCredentials {
+	creds := &ProcessCredentials{}
+	for key, id := range map[string]*uint32{
+		"uid":  &creds.RUID,
+		"euid": &creds.EUID,
+		"suid": &creds.SUID,
+		"gid":  &creds.RGID,
+		"egid": &creds.EGID,
+		"sgid": &creds.SGID,
+	} {
+		v, ok := r.getInt(key)
+		if !ok {
+			return nil
+		}
+		*id = uint32(v)
+	}
+	return creds
+}
+
+func (e auditEvent) newProcessEvent(process *Process) Event {
+	evt := NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: *process})
+	evt.Header.Time = e.Time
+	return evt
+}
+
+// getAuditArgv reassembles the arguments of an execve from one or more EXECVE records, including arguments which were split across multiple fields (e.g. a1_len=20000 a1[0]=... a1[1]=...).
+func getAuditArgv(records []*auditRecord) []string {
+	r := &auditRecord{Fields: make(map[string]auditField)}
+	for _, record := range records {
+		for k, v := range record.Fields {
+			r.Fields[k] = v
+		}
+	}
+	argc, ok := r.getInt("argc")
+	if !ok || argc < 0 || argc > auditMaxArgc {
+		return nil
+	}
+	var argv []string
+	for i := int64(0); i < argc; i++ {
+		key := "a" + strconv.FormatInt(i, 10)
+		if v, ok := r.getString(key); ok {
+			argv = append(argv, v)
+			continue
+		}
+		if _, ok := r.Fields[key+"_len"]; !ok {
+			// The remaining arguments were lost (e.g. the kernel ran out of memory while logging them).
+			break
+		}
+		var buf bytes.Buffer
+		for j := 0; ; j++ {
+			v, ok := r.getString(key + "[" + strconv.Itoa(j) + "]")
+			if !ok {
+				break
+			}
+			buf.WriteString(v)
+		}
+		argv = append(argv, buf.String())
+	}
+	return argv
+}
@@ -0,0 +1,173 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+// Constants from linux/audit.h.
+const (
+	_AUDIT_SET = 1001
+
+	_AUDIT_STATUS_ENABLED = 0x0001
+	_AUDIT_STATUS_PID     = 0x0004
+)
+
+const (
+	auditStatusSize         = 32 // mask, enabled, failure, pid, rate_limit, backlog_limit, lost, backlog
+	auditRecvBufferSize     = 64 * 1024
+	auditSocketBufferSize   = 8 * 1024 * 1024
+	auditSocketReadTimeout  = 250 * time.Millisecond
+	auditSocketReplyTimeout = 2 * time.Second
+)
+
+// auditClient receives audit records from the kernel by registering itself as the audit daemon.
+type auditClient struct {
+	fd  int
+	seq uint32
+}
+
+func newAuditClient() (*auditClient, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_AUDIT)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create netlink socket")
+	}
+	c := &auditClient{fd: fd}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "failed to bind netlink socket")
+	}
+	err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, auditSocketBufferSize)
+	if err != nil {
+		log.Debugf("Failed to increase netlink receive buffer size: %v", err)
+	}
+	tv := syscall.NsecToTimeval(auditSocketReadTimeout.Nanoseconds())
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "failed to set netlink socket timeout")
+	}
+
+	// Register ourselves as the audit daemon so that the kernel sends audit records to us.
+	err = c.setStatus(_AUDIT_STATUS_ENABLED|_AUDIT_STATUS_PID, 1, uint32(os.Getpid()))
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "failed to register as the audit daemon (is auditd running?)")
+	}
+	return c, nil
+}
+
+func (c *auditClient) Close() error {
+	err := c.setStatus(_AUDIT_STATUS_PID, 0, 0)
+	if err != nil {
+		log.Warnf("Failed to unregister as the audit daemon: %v", err)
+	}
+	return syscall.Close(c.fd)
+}
+
+func (c *auditClient) setStatus(mask, enabled, pid uint32) error {
+	ne := binary.NativeEndian
+	b := make([]byte, syscall.NLMSG_HDRLEN+auditStatusSize)
+	c.seq++
+
+	// struct nlmsghdr
+	ne.PutUint32(b[0:4], uint32(len(b)))
+	ne.PutUint16(b[4:6], _AUDIT_SET)
+	ne.PutUint16(b[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	ne.PutUint32(b[8:12], c.seq)
+
+	// struct audit_status
+	status := b[syscall.NLMSG_HDRLEN:]
+	ne.PutUint32(status[0:4], mask)
+	ne.PutUint32(status[4:8], enabled)
+	ne.PutUint32(status[12:16], pid)
+
+	err := syscall.Sendto(c.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		return err
+	}
+	return c.waitForAck(c.seq)
+}
+
+func (c *auditClient) waitForAck(seq uint32) error {
+	buf := make([]byte, auditRecvBufferSize)
+	deadline := time.Now().Add(auditSocketReplyTimeout)
+	for time.Now().Before(deadline) {
+		n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if msg.Header.Type != syscall.NLMSG_ERROR || msg.Header.Seq != seq {
+				continue
+			}
+			if len(msg.Data) < 4 {
+				return errors.New("short netlink error message")
+			}
+			errno := int32(binary.NativeEndian.Uint32(msg.Data[0:4]))
+			if errno != 0 {
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+	return errors.New("timed out waiting for a reply from the kernel")
+}
+
+// Run reads audit records from the kernel until the context is cancelled.
+func (c *auditClient) Run(ctx context.Context, m *AuditMonitor) error {
+	a := newAuditAssembler()
+	buf := make([]byte, auditRecvBufferSize)
+	m.setReady()
+	for ctx.Err() == nil {
+		n, from, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				sendAuditProcessEvents(m, a.Flush(time.Now().Add(-AuditEventTimeout)))
+				continue
+			}
+			if err == syscall.ENOBUFS {
+				log.Warnf("Netlink receive buffer overrun, some audit records were lost")
+				m.counters.kernelOverflows.Add(1)
+				continue
+			}
+			return errors.Wrap(err, "failed to read from netlink socket")
+		}
+		if sa, ok := from.(*syscall.SockaddrNetlink); !ok || sa.Pid != 0 {
+			continue
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			log.Warnf("Failed to parse netlink message: %v", err)
+			continue
+		}
+		for _, msg := range msgs {
+			recordType, ok := auditRecordTypes[msg.Header.Type]
+			if !ok {
+				continue
+			}
+			r, err := parseAuditRecord(recordType, string(bytes.TrimRight(msg.Data, "\x00\n")))
+			if err != nil {
+				log.Debugf("Skipping audit record: %v", err)
+				continue
+			}
+			sendAuditProcessEvents(m, a.Add(r))
+		}
+	}
+	return nil
+}
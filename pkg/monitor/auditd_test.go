@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuditLogFile(t *testing.T) {
+	events, err := ParseAuditLogFile("testdata/audit.log")
+	assert.Nil(t, err, "Failed to parse audit log")
+	assert.Equal(t, 3, len(events), "Failed executions and non-SYSCALL events should be ignored")
+
+	var processes []Process
+	for _, e := range events {
+		assert.Equal(t, ObjectType(ObjectTypeProcess), e.Header.ObjectType)
+		assert.Equal(t, EventType(EventTypeStarted), e.Header.EventType)
+		processes = append(processes, e.Data.(ProcessStartEventData).Process)
+	}
+
+	ls := processes[0]
+	assert.Equal(t, int32(4300), ls.PID)
+	assert.Equal(t, int32(4242), ls.PPID)
+	assert.Equal(t, "ls", ls.Name)
+	assert.Equal(t, []string{"ls", "-la"}, ls.Argv)
+	assert.Equal(t, 2, ls.Argc)
+	assert.Equal(t, "ls -la", ls.CommandLine)
+	assert.Equal(t, "/home/alice", ls.Cwd)
+	assert.Equal(t, "/usr/bin/ls", ls.Executable.Path)
+	assert.Equal(t, uint32(1000), ls.Credentials.EUID)
+	assert.Nil(t, ls.CreateTime, "The create time of a process isn't the time of the execve")
+	assert.Equal(t, time.UnixMilli(1707235200123), events[0].Header.Time)
+
+	// Hex encoded fields.
+	tool := processes[1]
+	assert.Equal(t, int32(4302), tool.PID)
+	assert.Equal(t, "my tool", tool.Name)
+	assert.Equal(t, []string{"my tool", "--message", `hello "world"`}, tool.Argv)
+	assert.Equal(t, "/tmp", tool.Cwd)
+	assert.Equal(t, "/opt/my tools/my tool", tool.Executable.Path)
+	assert.Equal(t, "my tool", tool.Executable.Filename)
+
+	// Arguments split across multiple fields, with records interleaved with another event.
+	sh := processes[2]
+	assert.Equal(t, int32(4303), sh.PID)
+	assert.Equal(t, []string{"sh", "-c", "echo hello"}, sh.Argv)
+	assert.Equal(t, "/", sh.Cwd)
+}
+
+func TestParseAuditLogInvalidArgc(t *testing.T) {
+	// The arguments of an EXECVE record with an invalid argument count are ignored in favour of the PROCTITLE record.
+	for _, argc := range []string{"-1", "9223372036854775807"} {
+		log := strings.Join([]string{
+			`type=SYSCALL msg=audit(1707235200.123:101): arch=c000003e syscall=59 success=yes exit=0 items=1 ppid=4242 pid=4300 uid=1000 gid=1000 euid=1000 comm="ls" exe="/usr/bin/ls"`,
+			`type=EXECVE msg=audit(1707235200.123:101): argc=` + argc + ` a0="ls" a1="-la"`,
+			`type=PROCTITLE msg=audit(1707235200.123:101): proctitle=6C73002D6C61`,
+			`type=EOE msg=audit(1707235200.123:101): `,
+		}, "\n")
+		events, err := ParseAuditLog(strings.NewReader(log))
+		assert.Nil(t, err)
+		if assert.Len(t, events, 1, argc) {
+			assert.Equal(t, []string{"ls", "-la"}, events[0].Data.(ProcessStartEventData).Argv, argc)
+		}
+	}
+}
+
+func TestParseAuditRecord(t *testing.T) {
+	r, err := parseAuditRecord("CWD", `audit(1707235200.123:101): cwd="/home/alice"`)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(101), r.Serial)
+	assert.Equal(t, time.UnixMilli(1707235200123), r.Time)
+	cwd, ok := r.getString("cwd")
+	assert.True(t, ok)
+	assert.Equal(t, "/home/alice", cwd)
+
+	_, err = parseAuditRecord("CWD", `cwd="/home/alice"`)
+	assert.NotNil(t, err)
+}
+
+func TestAuditAssemblerFlushesOnEOE(t *testing.T) {
+	a := newAuditAssembler()
+	r, _ := parseAuditRecord(auditRecordTypeSyscall, `audit(1707235200.123:101): success=yes pid=1 ppid=0`)
+	assert.Empty(t, a.Add(r))
+
+	eoe, _ := parseAuditRecord(auditRecordTypeEOE, `audit(1707235200.123:101): `)
+	completed := a.Add(eoe)
+	assert.Equal(t, 1, len(completed))
+	assert.Equal(t, 1, len(completed[0].Records))
+	assert.Empty(t, a.FlushAll())
+}
+
+func TestAuditLogReaderReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	w, err := os.Create(path)
+	assert.Nil(t, err)
+	defer w.Close()
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	r := newAuditLogReader(f)
+	defer r.Close()
+
+	_, err = w.WriteString("type=CWD msg=audit(1707235200.123:101): cwd=\"/a\"\ntype=CWD msg=audit(1707235200.123:102): ")
+	assert.Nil(t, err)
+	records, err := r.Read()
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	records, err = r.Reopen(path)
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	// Records written to the old file after it was last read aren't lost when it's rotated.
+	_, err = w.WriteString("cwd=\"/b\"\ntype=CWD msg=audit(1707235200.123:103): cwd=\"/c\"\n")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Rename(path, path+".1"))
+	assert.Nil(t, os.WriteFile(path, []byte("type=CWD msg=audit(1707235200.123:104): cwd=\"/d\"\n"), 0o600))
+	records, err = r.Reopen(path)
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, []uint64{102, 103}, []uint64{records[0].Serial, records[1].Serial})
+
+	records, err = r.Read()
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, uint64(104), records[0].Serial)
+}
+
+func TestSendAuditProcessEventsCachesGUIDs(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.processes = newProcessCache(10)
+	pid := os.Getpid()
+
+	a := newAuditAssembler()
+	for _, record := range [][2]string{
+		{auditRecordTypeSyscall, fmt.Sprintf(`audit(1707235200.123:101): success=yes pid=%d ppid=%d comm="monitor.test"`, pid, os.Getppid())},
+		{auditRecordTypeExecve, `audit(1707235200.123:101): argc=1 a0="monitor.test"`},
+		{auditRecordTypeEOE, `audit(1707235200.123:101): `},
+	} {
+		r, err := parseAuditRecord(record[0], record[1])
+		assert.Nil(t, err)
+		sendAuditProcessEvents(m, a.Add(r))
+	}
+
+	// The process is described by its GUID when it's an ancestor of another process.
+	id, err := getProcessIdentity(int32(pid))
+	assert.Nil(t, err)
+	ancestor, ok := m.processes.Get(int32(pid))
+	assert.True(t, ok)
+	assert.Equal(t, id.GUID(), ancestor.GUID)
+	assert.Len(t, readEvents(m), 1)
+}
@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"strings"
+)
+
+const (
+	ContainerRuntimeDocker     = "docker"
+	ContainerRuntimeContainerd = "containerd"
+	ContainerRuntimeCRIO       = "cri-o"
+	ContainerRuntimePodman     = "podman"
+)
+
+// ProcessNamespaces are the inode numbers of the namespaces of a process (processes in the same namespace have the same inode number).
+type ProcessNamespaces struct {
+	PID   uint64 `json:"pid,omitempty"`
+	Mount uint64 `json:"mnt,omitempty"`
+	User  uint64 `json:"user,omitempty"`
+}
+
+// matchesContainer returns true if a process is running in the container with the given ID (or ID prefix, e.g. the 12 character IDs printed by docker ps).
+func matchesContainer(p *Process, id string) bool {
+	return p.ContainerId != "" && id != "" && strings.HasPrefix(p.ContainerId, strings.ToLower(id))
+}
+
+// matchesCgroup returns true if a process is in the given cgroup or any of its descendants.
+func matchesCgroup(p *Process, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return p.Cgroup == prefix || strings.HasPrefix(p.Cgroup, prefix+"/") || (prefix == "" && p.Cgroup != "")
+}
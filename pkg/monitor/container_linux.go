@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// containerIdPattern matches a path segment of a cgroup which contains the (64 character hexadecimal) ID of a container, e.g. docker-<id>.scope when using the systemd cgroup driver, or <id> when using the cgroupfs driver.
+var containerIdPattern = regexp.MustCompile(`^(?:(docker|cri-containerd|crio|libpod)-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+var containerRuntimesByPrefix = map[string]string{
+	"docker":         ContainerRuntimeDocker,
+	"cri-containerd": ContainerRuntimeContainerd,
+	"crio":           ContainerRuntimeCRIO,
+	"libpod":         ContainerRuntimePodman,
+}
+
+// containerRuntimesByParent identifies the runtime of containers using the cgroupfs driver, whose cgroup is named after the container ID alone, by the name of the parent cgroup.
+var containerRuntimesByParent = map[string]string{
+	"docker":        ContainerRuntimeDocker,
+	"libpod_parent": ContainerRuntimePodman,
+}
+
+func setProcessContainer(p *Process) {
+	b, err := os.ReadFile(procPath(p.PID, "cgroup"))
+	if err == nil {
+		p.Cgroup, p.ContainerId, p.ContainerRuntime = parseProcCgroup(b)
+	}
+	p.Namespaces = readProcNamespaces(p.PID)
+}
+
+// parseProcCgroup parses /proc/<pid>/cgroup (see cgroups(7)), returning the cgroup of the process and the ID and runtime of the container it's running in (if any).
+//
+// The unified (cgroup v2) hierarchy is preferred. On hosts which only use cgroup v1, the first hierarchy in which the process isn't in the root cgroup is used.
+func parseProcCgroup(b []byte) (cgroup, containerId, runtime string) {
+	var unified, fallback string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		path := parts[2]
+		if containerId == "" {
+			containerId, runtime = parseContainerId(path)
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = path
+		} else if fallback == "" && path != "/" {
+			fallback = path
+		}
+	}
+	switch {
+	case unified != "" && unified != "/":
+		cgroup = unified
+	case fallback != "":
+		cgroup = fallback
+	default:
+		cgroup = unified
+	}
+	return cgroup, containerId, runtime
+}
+
+// parseContainerId returns the ID and runtime of the container that a cgroup belongs to (e.g. /kubepods.slice/kubepods-pod<uid>.slice/cri-containerd-<id>.scope). The runtime is empty if it can't be determined (e.g. for Kubernetes using the cgroupfs driver).
+func parseContainerId(cgroup string) (id, runtime string) {
+	segments := strings.Split(cgroup, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		m := containerIdPattern.FindStringSubmatch(segments[i])
+		if m == nil {
+			continue
+		}
+		if m[1] != "" {
+			return m[2], containerRuntimesByPrefix[m[1]]
+		}
+		if i > 0 {
+			return m[2], containerRuntimesByParent[segments[i-1]]
+		}
+		return m[2], ""
+	}
+	return "", ""
+}
+
+func readProcNamespaces(pid int32) *ProcessNamespaces {
+	ns := &ProcessNamespaces{}
+	for name, inode := range map[string]*uint64{
+		"pid":  &ns.PID,
+		"mnt":  &ns.Mount,
+		"user": &ns.User,
+	} {
+		link, err := os.Readlink(procPath(pid, "ns", name))
+		if err != nil {
+			continue
+		}
+		*inode, _ = parseNamespaceInode(link)
+	}
+	if ns.PID == 0 && ns.Mount == 0 && ns.User == 0 {
+		return nil
+	}
+	return ns
+}
+
+// parseNamespaceInode parses the target of a /proc/<pid>/ns/<name> link (e.g. pid:[4026531836]).
+func parseNamespaceInode(link string) (uint64, error) {
+	start := strings.IndexByte(link, '[')
+	end := strings.LastIndexByte(link, ']')
+	if start < 0 || end < start {
+		return 0, errors.Errorf("malformed namespace: %s", link)
+	}
+	return strconv.ParseUint(link[start+1:end], 10, 64)
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withProcRoot(t *testing.T, root string) {
+	previous := procRoot
+	procRoot = root
+	t.Cleanup(func() {
+		procRoot = previous
+	})
+}
+
+func TestSetProcessContainer(t *testing.T) {
+	withProcRoot(t, "testdata/proc")
+
+	tests := []struct {
+		pid     int32
+		id      string
+		runtime string
+		cgroup  string
+	}{
+		{100, strings.Repeat("a", 64), ContainerRuntimeDocker, "/system.slice/docker-" + strings.Repeat("a", 64) + ".scope"},
+		{200, strings.Repeat("3", 32) + strings.Repeat("b", 32), ContainerRuntimeContainerd, ""},
+		{300, strings.Repeat("c", 64), ContainerRuntimeCRIO, "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0c1d2e3f.slice/crio-" + strings.Repeat("c", 64) + ".scope"},
+		{400, strings.Repeat("d", 64), ContainerRuntimePodman, ""},
+		{500, strings.Repeat("e", 64), ContainerRuntimeDocker, "/docker/" + strings.Repeat("e", 64)},
+		{600, "", "", "/user.slice/user-1000.slice/session-3.scope"},
+	}
+	for _, test := range tests {
+		p := &Process{PID: test.pid}
+		setProcessContainer(p)
+		assert.Equal(t, test.id, p.ContainerId, test.pid)
+		assert.Equal(t, test.runtime, p.ContainerRuntime, test.pid)
+		if test.cgroup != "" {
+			assert.Equal(t, test.cgroup, p.Cgroup, test.pid)
+		}
+	}
+
+	p := &Process{PID: 100}
+	setProcessContainer(p)
+	assert.Equal(t, &ProcessNamespaces{PID: 4026532301, Mount: 4026532299, User: 4026531837}, p.Namespaces)
+
+	f := &ProcessFilter{ContainerIds: []string{"aaaaaaaaaaaa"}}
+	assert.True(t, f.MatchesProcess(p, nil))
+	f = &ProcessFilter{Cgroups: []string{"/system.slice/"}}
+	assert.True(t, f.MatchesProcess(p, nil))
+	f = &ProcessFilter{Cgroups: []string{"/system"}}
+	assert.False(t, f.MatchesProcess(p, nil))
+}
@@ -0,0 +1,3 @@
+package monitor
+
+func setProcessContainer(p *Process) {}
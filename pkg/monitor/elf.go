@@ -0,0 +1,255 @@
+package monitor
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+)
+
+var (
+	ELFCacheSize = 1024
+)
+
+// _NT_GNU_BUILD_ID is the type of the note which contains the build ID (see include/uapi/linux/elf.h).
+const _NT_GNU_BUILD_ID = 3
+
+// ELF describes an ELF executable or shared library.
+type ELF struct {
+	Class       string `json:"class"`
+	Machine     string `json:"machine"`
+	Type        string `json:"type"`
+	Interpreter string `json:"interpreter,omitempty"`
+	BuildId     string `json:"build_id,omitempty"`
+
+	// ImportedLibraries are the shared libraries the file depends on (i.e. DT_NEEDED).
+	ImportedLibraries []string `json:"imported_libraries,omitempty"`
+
+	// Stripped is set if the file has no symbol table, and Static if it's an executable which doesn't depend on any shared libraries.
+	Stripped bool `json:"stripped"`
+	Static   bool `json:"static"`
+	PIE      bool `json:"pie"`
+
+	// Sections are missing if the section headers have been removed (e.g. by a packer).
+	Sections []ELFSection `json:"sections,omitempty"`
+}
+
+type ELFSection struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+
+	// Entropy is the Shannon entropy of the contents of the section in bits per byte (0-8), where values close to 8 indicate compressed or encrypted data. Only the head and tail of sections larger than HashOptions.MaxSize are read.
+	Entropy float64 `json:"entropy"`
+}
+
+// GetELF parses the metadata of an ELF file.
+func GetELF(path string) (*ELF, error) {
+	return GetELFWithOptions(path, nil)
+}
+
+// GetELFWithOptions parses the metadata of an ELF file, using the size limits of the hash options when calculating the entropy of its sections.
+func GetELFWithOptions(path string, opts *HashOptions) (*ELF, error) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	e := &ELF{
+		Class:   f.Class.String(),
+		Machine: f.Machine.String(),
+		Type:    f.Type.String(),
+	}
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		b, err := io.ReadAll(p.Open())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read interpreter")
+		}
+		e.Interpreter = string(bytes.TrimRight(b, "\x00"))
+	}
+	e.ImportedLibraries, _ = f.ImportedLibraries()
+	e.PIE = isPIE(f, e.Interpreter)
+	e.Static = (f.Type == elf.ET_EXEC || e.PIE) && e.Interpreter == "" && len(e.ImportedLibraries) == 0
+	e.Stripped = f.Section(".symtab") == nil
+
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+		section := ELFSection{
+			Name: s.Name,
+			Size: s.Size,
+		}
+		if s.Type != elf.SHT_NOBITS && s.Size > 0 {
+			section.Entropy, err = calculateEntropy(sampleSection(s, opts))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read section: %s", s.Name)
+			}
+		}
+		e.Sections = append(e.Sections, section)
+		if s.Name == ".note.gnu.build-id" {
+			e.BuildId, _ = readBuildId(s, f.ByteOrder)
+		}
+	}
+	return e, nil
+}
+
+// isPIE returns true if a file is a position independent executable, as opposed to a shared library (both of which are ET_DYN). Files linked without DF_1_PIE are assumed to be executables if they have an interpreter but no soname, since some shared libraries have an interpreter too (e.g. libc.so.6).
+func isPIE(f *elf.File, interpreter string) bool {
+	if f.Type != elf.ET_DYN {
+		return false
+	}
+	flags, err := f.DynValue(elf.DT_FLAGS_1)
+	if err == nil && len(flags) > 0 && flags[0]&uint64(elf.DF_1_PIE) != 0 {
+		return true
+	}
+	soname, _ := f.DynString(elf.DT_SONAME)
+	return interpreter != "" && len(soname) == 0
+}
+
+// sampleSection returns the contents of a section, or only its head and tail if it's larger than the maximum size (see HashOptions).
+func sampleSection(s *elf.Section, opts *HashOptions) io.Reader {
+	size := int64(s.Size)
+	if opts.MaxSize <= 0 || size <= opts.MaxSize || size <= 2*opts.PartialSize {
+		return s.Open()
+	}
+	head := io.LimitReader(s.Open(), opts.PartialSize)
+	tail := s.Open()
+	_, err := tail.Seek(size-opts.PartialSize, io.SeekStart)
+	if err != nil {
+		return head
+	}
+	return io.MultiReader(head, tail)
+}
+
+// readBuildId reads the GNU build ID from a note section (see elf(5)).
+func readBuildId(s *elf.Section, order binary.ByteOrder) (string, error) {
+	b, err := s.Data()
+	if err != nil {
+		return "", err
+	}
+	for len(b) >= 12 {
+		nameSize := int(order.Uint32(b[0:4]))
+		descSize := int(order.Uint32(b[4:8]))
+		noteType := order.Uint32(b[8:12])
+		nameEnd := 12 + align4(nameSize)
+		descEnd := nameEnd + align4(descSize)
+		if nameEnd+descSize > len(b) {
+			break
+		}
+		name := string(bytes.TrimRight(b[12:12+nameSize], "\x00"))
+		if name == "GNU" && noteType == _NT_GNU_BUILD_ID {
+			return hex.EncodeToString(b[nameEnd : nameEnd+descSize]), nil
+		}
+		if descEnd > len(b) {
+			break
+		}
+		b = b[descEnd:]
+	}
+	return "", errors.New("no build ID")
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// calculateEntropy calculates the Shannon entropy of data in bits per byte, rounded to 3 decimal places.
+func calculateEntropy(r io.Reader) (float64, error) {
+	var counts [256]uint64
+	var total uint64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, c := range buf[:n] {
+			counts[c]++
+		}
+		total += uint64(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return math.Round(entropy*1000) / 1000, nil
+}
+
+var (
+	elfCache     *lru.Cache
+	elfCacheOnce sync.Once
+)
+
+func getELFCache() *lru.Cache {
+	elfCacheOnce.Do(func() {
+		var err error
+		elfCache, err = lru.New(ELFCacheSize)
+		if err != nil {
+			log.Fatalf("Failed to create ELF cache: %v", err)
+		}
+	})
+	return elfCache
+}
+
+// GetCachedELF returns the metadata of an ELF file, only parsing the file if it has changed since it was last parsed.
+func GetCachedELF(path string, opts *HashOptions) (*ELF, error) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
+	k, err := getFileKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if k.ino == 0 {
+		return GetELFWithOptions(path, opts)
+	}
+	cache := getELFCache()
+	key := hashCacheKey{file: *k, opts: opts.key()}
+	if v, ok := cache.Get(key); ok {
+		return v.(*ELF), nil
+	}
+	e, err := GetELFWithOptions(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	cache.Add(key, e)
+	return e, nil
+}
+
+// getCachedELF returns the metadata of an ELF file if it has already been parsed.
+func getCachedELF(path string, opts *HashOptions) (*ELF, bool) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
+	k, err := getFileKey(path)
+	if err != nil || k.ino == 0 {
+		return nil, false
+	}
+	v, ok := getELFCache().Get(hashCacheKey{file: *k, opts: opts.key()})
+	if !ok {
+		return nil, false
+	}
+	return v.(*ELF), true
+}
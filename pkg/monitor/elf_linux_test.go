@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetELF(t *testing.T) {
+	path, err := os.Executable()
+	assert.Nil(t, err)
+	e, err := GetCachedELF(path, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ELFCLASS64", e.Class)
+	assert.NotEmpty(t, e.Machine)
+	assert.NotEmpty(t, e.Sections)
+
+	cached, err := GetCachedELF(path, nil)
+	assert.Nil(t, err)
+	assert.Same(t, e, cached)
+
+	// The executables shipped by most distributions are stripped, dynamically linked PIEs.
+	e, err = GetELF("/bin/sh")
+	if err != nil {
+		t.Skipf("Failed to parse /bin/sh: %v", err)
+	}
+	assert.Equal(t, "ET_DYN", e.Type)
+	assert.NotEmpty(t, e.Interpreter)
+	assert.Contains(t, e.ImportedLibraries, "libc.so.6")
+	assert.NotEmpty(t, e.BuildId)
+	assert.False(t, e.Static)
+	assert.True(t, e.PIE)
+
+	path = filepath.Join(t.TempDir(), "script.sh")
+	assert.Nil(t, os.WriteFile(path, []byte("#!/bin/sh\necho hello\n"), 0o700))
+	_, err = GetCachedELF(path, nil)
+	assert.NotNil(t, err)
+}
+
+func TestGetELFLibrary(t *testing.T) {
+	// Shared libraries aren't position independent executables or statically linked, even if they have an interpreter (e.g. libc.so.6).
+	var paths []string
+	for _, pattern := range []string{"/lib/*/libc.so.6", "/usr/lib/*/libc.so.6", "/lib*/libc.so.6", "/usr/lib*/libc.so.6"} {
+		matches, _ := filepath.Glob(pattern)
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		t.Skip("libc.so.6 not found")
+	}
+	e, err := GetELF(paths[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "ET_DYN", e.Type)
+	assert.False(t, e.PIE)
+	assert.False(t, e.Static)
+}
+
+func TestGetELFWithOptions(t *testing.T) {
+	// Only the head and tail of large sections are read, so their entropy can't be more than that of 32 distinct bytes.
+	opts := &HashOptions{Algorithms: []string{HashSHA256}, MaxSize: 64, PartialSize: 16}
+	e, err := GetELFWithOptions("/bin/sh", opts)
+	if err != nil {
+		t.Skipf("Failed to parse /bin/sh: %v", err)
+	}
+	sampled := 0
+	for _, s := range e.Sections {
+		if s.Size > uint64(opts.MaxSize) {
+			assert.LessOrEqual(t, s.Entropy, 5.0, s.Name)
+			sampled++
+		}
+	}
+	assert.NotZero(t, sampled)
+
+	// The metadata is cached separately for each set of options.
+	a, err := GetCachedELF("/bin/sh", opts)
+	assert.Nil(t, err)
+	b, err := GetCachedELF("/bin/sh", nil)
+	assert.Nil(t, err)
+	assert.NotSame(t, a, b)
+	c, ok := getCachedELF("/bin/sh", opts)
+	assert.True(t, ok)
+	assert.Same(t, a, c)
+}
+
+func TestCalculateEntropy(t *testing.T) {
+	entropy, err := calculateEntropy(bytes.NewReader(make([]byte, 1024)))
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, entropy)
+
+	b := make([]byte, 0, 1024)
+	for i := 0; i < 1024; i++ {
+		b = append(b, byte(i))
+	}
+	entropy, err = calculateEntropy(bytes.NewReader(b))
+	assert.Nil(t, err)
+	assert.Equal(t, 8.0, entropy)
+
+	entropy, err = calculateEntropy(bytes.NewReader([]byte("aabb")))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, entropy)
+}
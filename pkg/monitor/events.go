@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,13 +11,45 @@ type ObjectType string
 
 const (
 	ObjectTypeProcess = "process"
+	ObjectTypeMonitor = "monitor"
+	ObjectTypeHost    = "host"
+	ObjectTypeFile    = "file"
+
+	ObjectTypeNetworkConnection = "network_connection"
 )
 
 type EventType string
 
 const (
-	EventTypeStarted = "started"
-	EventTypeStopped = "stopped"
+	EventTypeStarted  = "started"
+	EventTypeStopped  = "stopped"
+	EventTypeModified = "modified"
+	EventTypeCreated  = "created"
+	EventTypeDeleted  = "deleted"
+	EventTypeRenamed  = "renamed"
+
+	// EventTypeOpened, EventTypeExecuted, and EventTypeWritten describe a file which was opened, executed, or closed after being written to by a process.
+	EventTypeOpened   = "opened"
+	EventTypeExecuted = "executed"
+	EventTypeWritten  = "written"
+
+	// EventTypeClosed describes a network connection which was closed (and EventTypeOpened, one which was opened).
+	EventTypeClosed = "closed"
+
+	// EventTypeModuleLoaded describes a shared library which was loaded by a running process (e.g. using dlopen).
+	EventTypeModuleLoaded = "module_loaded"
+
+	// EventTypeRunning describes a process which was already running when a snapshot was taken (e.g. when the monitor started).
+	EventTypeRunning = "running"
+
+	// EventTypeEnriched follows an event which was sent before all of its details were available (e.g. the hashes of an executable).
+	EventTypeEnriched = "enriched"
+
+	// EventTypeTelemetry is periodically emitted by the monitor to report on itself.
+	EventTypeTelemetry = "telemetry"
+
+	// EventTypeInventory describes a host, and is periodically emitted by the monitor so that the host ID in each event header can be resolved.
+	EventTypeInventory = "inventory"
 )
 
 type Event struct {
@@ -24,15 +57,152 @@ type Event struct {
 	Data   interface{} `json:"data"`
 }
 
+// UnmarshalJSON decodes the data of an event into the type used for its object and event type (e.g. ProcessStartEventData for a process started event), or leaves it as raw JSON if the type is unknown.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Header EventHeader     `json:"header"`
+		Data   json.RawMessage `json:"data"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+	e.Header = raw.Header
+	e.Data, err = unmarshalEventData(raw.Header, raw.Data)
+	return err
+}
+
+func unmarshalEventData(h EventHeader, b json.RawMessage) (interface{}, error) {
+	switch h.ObjectType {
+	case ObjectTypeProcess:
+		switch h.EventType {
+		case EventTypeStarted, EventTypeRunning:
+			return unmarshalAs[ProcessStartEventData](b)
+		case EventTypeStopped:
+			return unmarshalAs[ProcessStopEventData](b)
+		case EventTypeModified:
+			return unmarshalAs[ProcessModifyEventData](b)
+		case EventTypeEnriched:
+			return unmarshalAs[ProcessEnrichEventData](b)
+		case EventTypeModuleLoaded:
+			return unmarshalAs[ProcessModuleLoadEventData](b)
+		}
+	case ObjectTypeFile:
+		return unmarshalAs[FileEventData](b)
+	case ObjectTypeNetworkConnection:
+		return unmarshalAs[NetworkConnection](b)
+	case ObjectTypeMonitor:
+		if h.EventType == EventTypeTelemetry {
+			return unmarshalAs[MonitorTelemetryEventData](b)
+		}
+	case ObjectTypeHost:
+		if h.EventType == EventTypeInventory {
+			return unmarshalAs[HostInventory](b)
+		}
+	}
+	return b, nil
+}
+
+func unmarshalAs[T any](b []byte) (interface{}, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
 type ProcessStartEventData struct {
 	Process
 }
 
 type ProcessStopEventData struct {
+	GUID       string     `json:"guid,omitempty"`
+	ParentGUID string     `json:"parent_guid,omitempty"`
 	PID        int32      `json:"pid"`
 	PPID       *int32     `json:"ppid,omitempty"`
 	CreateTime *time.Time `json:"create_time,omitempty"`
 	ExitTime   *time.Time `json:"exit_time,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Signal     *int       `json:"signal,omitempty"`
+
+	// Lifetime is the number of seconds between the create time and exit time.
+	Lifetime *float64 `json:"lifetime_seconds,omitempty"`
+}
+
+func newProcessStopEventData(id ProcessIdentity, getIdentity func(pid int32) (*ProcessIdentity, error)) *ProcessStopEventData {
+	ppid := id.PPID
+	d := &ProcessStopEventData{
+		GUID:       id.GUID(),
+		PID:        id.PID,
+		PPID:       &ppid,
+		CreateTime: id.CreateTime(),
+	}
+	if parent, err := getIdentity(id.PPID); err == nil {
+		d.ParentGUID = parent.GUID()
+	}
+	return d
+}
+
+func (d *ProcessStopEventData) calculateLifetime() {
+	if d.CreateTime == nil || d.ExitTime == nil {
+		return
+	}
+	lifetime := d.ExitTime.Sub(*d.CreateTime).Seconds()
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	d.Lifetime = &lifetime
+}
+
+type ProcessModifyEventData struct {
+	GUID string  `json:"guid,omitempty"`
+	PID  int32   `json:"pid"`
+	Name string  `json:"name,omitempty"`
+	RUID *uint32 `json:"ruid,omitempty"`
+	EUID *uint32 `json:"euid,omitempty"`
+	RGID *uint32 `json:"rgid,omitempty"`
+	EGID *uint32 `json:"egid,omitempty"`
+}
+
+type ProcessEnrichEventData struct {
+	GUID       string `json:"guid,omitempty"`
+	PID        int32  `json:"pid"`
+	Executable *File  `json:"executable,omitempty"`
+
+	// Modules are the modules of the process, including any hashes which weren't available when it started (omitted if none of them were pending).
+	Modules []Module `json:"modules,omitempty"`
+}
+
+type FileEventData struct {
+	// File is the file after the event (omitted if a file was renamed to somewhere outside of the watched directories).
+	File *File `json:"file,omitempty"`
+
+	// OldPath is the previous path of a renamed file.
+	OldPath string `json:"old_path,omitempty"`
+
+	// Process is the process which accessed the file (fanotify only).
+	Process *ProcessAncestor `json:"process,omitempty"`
+}
+
+type MonitorTelemetryEventData struct {
+	Backend        string  `json:"backend"`
+	OverflowPolicy string  `json:"overflow_policy"`
+	Uptime         float64 `json:"uptime_seconds"`
+
+	// Events is the total number of events emitted, including those which were dropped or spilled.
+	Events        uint64 `json:"events"`
+	DroppedNewest uint64 `json:"dropped_newest"`
+	DroppedOldest uint64 `json:"dropped_oldest"`
+	Spilled       uint64 `json:"spilled"`
+
+	// KernelOverflows is the number of times the kernel dropped events before they could be read (i.e. the fanotify queue or a netlink receive buffer overflowed), each of which may have lost any number of events.
+	KernelOverflows uint64 `json:"kernel_overflows"`
+
+	// QueueLength is the number of events waiting to be read from AuditMonitor.Events, and SpillQueueLength the number waiting on disk.
+	QueueLength      int `json:"queue_length"`
+	QueueCapacity    int `json:"queue_capacity"`
+	SpillQueueLength int `json:"spill_queue_length"`
 }
 
 type EventHeader struct {
@@ -40,6 +210,13 @@ type EventHeader struct {
 	Time       time.Time  `json:"time"`
 	ObjectType ObjectType `json:"object_type"`
 	EventType  EventType  `json:"event_type"`
+	HostId     string     `json:"host_id,omitempty"`
+
+	// Host is only set if AuditMonitorOptions.IncludeHost is set.
+	Host *Host `json:"host,omitempty"`
+
+	// Backfilled is set on events which were reconstructed after the fact (e.g. processes which started or stopped while the monitor wasn't running).
+	Backfilled bool `json:"backfilled,omitempty"`
 }
 
 func NewEvent(objectType ObjectType, eventType EventType, details interface{}) Event {
@@ -49,6 +226,7 @@ func NewEvent(objectType ObjectType, eventType EventType, details interface{}) E
 			Time:       time.Now(),
 			ObjectType: objectType,
 			EventType:  eventType,
+			HostId:     GetHostId(),
 		},
 		Data: details,
 	}
@@ -8,6 +8,9 @@ type File struct {
 	Path     string  `json:"path"`
 	Filename string  `json:"filename"`
 	Hashes   *Hashes `json:"hashes"`
+
+	// ELF is only set for ELF files if requested (e.g. ProcessOptions.IncludeELF).
+	ELF *ELF `json:"elf,omitempty"`
 }
 
 func NewFile(path string) File {
@@ -20,10 +23,27 @@ func NewFile(path string) File {
 
 func GetFile(path string) (*File, error) {
 	file := NewFile(path)
-	hashes, err := GetFileHashes(file.Path)
+	hashes, err := GetCachedFileHashes(file.Path, nil)
 	if err != nil {
 		return nil, err
 	}
 	file.Hashes = hashes
 	return &file, nil
 }
+
+// withHashes returns a copy of the file with the given hashes, leaving the original untouched since it may have already been sent.
+func (f File) withHashes(hashes *Hashes) *File {
+	f.Hashes = hashes
+	return &f
+}
+
+// withResult returns a copy of the file with the hashes and ELF metadata read by the hash pool.
+func (f File) withResult(r hashResult) *File {
+	if r.hashes != nil {
+		f.Hashes = r.hashes
+	}
+	if r.elf != nil {
+		f.ELF = r.elf
+	}
+	return &f
+}
@@ -0,0 +1,14 @@
+package monitor
+
+import (
+	"os"
+	"syscall"
+)
+
+func getFileId(info os.FileInfo) (dev, ino uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Dev), uint64(st.Ino)
+}
@@ -0,0 +1,413 @@
+package monitor
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/whitfieldsdad/go-audit/pkg/util"
+)
+
+const (
+	// FileBackendFsnotify reports files which are created, modified, deleted, or renamed using inotify (Linux), kqueue (macOS), or ReadDirectoryChangesW (Windows).
+	FileBackendFsnotify = "fsnotify"
+
+	// FileBackendFanotify reports files which are opened, executed, modified, or written, and by which process, using fanotify (Linux, requires CAP_SYS_ADMIN).
+	FileBackendFanotify = "fanotify"
+)
+
+// File access events reported by the fanotify backend (see FileMonitorOptions.Events).
+const (
+	FileAccessOpen       = "open"
+	FileAccessExec       = "exec"
+	FileAccessModify     = "modify"
+	FileAccessCloseWrite = "close_write"
+)
+
+var fileAccessEventTypes = map[string]EventType{
+	FileAccessOpen:       EventTypeOpened,
+	FileAccessExec:       EventTypeExecuted,
+	FileAccessModify:     EventTypeModified,
+	FileAccessCloseWrite: EventTypeWritten,
+}
+
+type FileMonitorOptions struct {
+	Backend string `json:"backend,omitempty"`
+
+	// Paths are the directories (or with the fanotify backend, files) to watch (e.g. /etc, /var/spool/cron, /var/www).
+	Paths     []string `json:"paths"`
+	Recursive bool     `json:"recursive"`
+
+	// Mount watches the whole mount containing each path instead (fanotify only).
+	Mount bool `json:"mount,omitempty"`
+
+	// Events are the file accesses to report (fanotify only): open, exec, modify, and/or close_write (defaults to all of them).
+	Events []string `json:"events,omitempty"`
+
+	// Include and Exclude are globs matched against the path of each file (e.g. /etc/**.conf); a file is reported if it matches any Include glob (or if there are none) and no Exclude glob.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Debounce is how long a file must go without being changed before it's reported, so that e.g. a file being written in chunks is only reported (and hashed) once.
+	Debounce time.Duration `json:"debounce"`
+
+	// IncludeHashes hashes created, modified, renamed, written, and executed files using AuditMonitorOptions.HashOptions.
+	IncludeHashes bool `json:"include_hashes"`
+
+	// IncludeELF parses the ELF metadata of the same files (e.g. to identify executables which are dropped into /tmp).
+	IncludeELF bool `json:"include_elf,omitempty"`
+}
+
+func GetDefaultFileMonitorOptions() *FileMonitorOptions {
+	return &FileMonitorOptions{
+		Backend:       FileBackendFsnotify,
+		Recursive:     true,
+		Debounce:      500 * time.Millisecond,
+		IncludeHashes: true,
+	}
+}
+
+type fileAccessKey struct {
+	pid  int32
+	path string
+}
+
+// pendingFileEvent is a change to a file which hasn't been reported yet.
+type pendingFileEvent struct {
+	eventType EventType
+	oldPath   string
+	updated   time.Time
+}
+
+// queuedFileEvent is a file event which is waiting for its file to be hashed and/or parsed.
+type queuedFileEvent struct {
+	event  Event
+	file   *File
+	result <-chan hashResult
+}
+
+// fileWatcher turns fsnotify events into file events.
+type fileWatcher struct {
+	opts    *FileMonitorOptions
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	watcher *fsnotify.Watcher
+	pending map[string]*pendingFileEvent
+
+	// queue holds the events which are waiting for their files to be hashed by contents, so that they're sent in order without blocking the watcher (see startEmitting).
+	queue    chan queuedFileEvent
+	contents *hashPool
+	emitted  chan struct{}
+
+	// modified are the files which have been reported as modified by each process since they were last written (fanotify only).
+	modified map[fileAccessKey]struct{}
+
+	// renamed is the old path of the last file renamed, which is paired with the create event for its new path if it was renamed within the watched directories.
+	renamed     string
+	renamedTime time.Time
+}
+
+func newFileWatcher(opts *FileMonitorOptions) (*fileWatcher, error) {
+	if len(opts.Paths) == 0 {
+		return nil, errors.New("no paths to watch")
+	}
+	if opts.Debounce <= 0 {
+		return nil, errors.New("debounce must be greater than 0")
+	}
+	switch opts.Backend {
+	case "":
+		opts.Backend = FileBackendFsnotify
+	case FileBackendFsnotify, FileBackendFanotify:
+	default:
+		return nil, errors.Errorf("unsupported file monitor backend: %s", opts.Backend)
+	}
+	for _, event := range opts.Events {
+		if _, ok := fileAccessEventTypes[event]; !ok {
+			return nil, errors.Errorf("unsupported file access event: %s", event)
+		}
+	}
+	w := &fileWatcher{
+		opts:     opts,
+		pending:  make(map[string]*pendingFileEvent),
+		modified: make(map[fileAccessKey]struct{}),
+	}
+	for _, pattern := range opts.Include {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		w.include = append(w.include, re)
+	}
+	for _, pattern := range opts.Exclude {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		w.exclude = append(w.exclude, re)
+	}
+	return w, nil
+}
+
+func (w *fileWatcher) matches(path string) bool {
+	if len(w.include) > 0 {
+		included := false
+		for _, re := range w.include {
+			if re.MatchString(path) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, re := range w.exclude {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *AuditMonitor) watchFiles(ctx context.Context) {
+	w := m.files
+	opts := w.opts
+	pool := m.hashes
+	if pool == nil && (opts.IncludeHashes || opts.IncludeELF) {
+		pool = newHashPool(m.Options.HashWorkers, EventBufferSize, m.Options.HashOptions)
+		defer pool.Close()
+	}
+	w.startEmitting(ctx, m, pool)
+	defer w.stopEmitting()
+
+	if opts.Backend == FileBackendFanotify {
+		err := w.runFanotify(ctx, m)
+		if err != nil {
+			log.Errorf("Failed to watch files: %v", err)
+		}
+		return
+	}
+	var err error
+	for _, path := range opts.Paths {
+		if w.watcher == nil {
+			w.watcher, err = util.CreateDirectoryWatcher(path, opts.Recursive)
+		} else {
+			_, err = util.AddDirectory(w.watcher, path, opts.Recursive)
+		}
+		if err != nil {
+			log.Errorf("Failed to watch %s: %v", path, err)
+		}
+	}
+	if w.watcher == nil {
+		return
+	}
+	defer w.watcher.Close()
+
+	ticker := time.NewTicker(opts.Debounce)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush(m, time.Time{})
+			return
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(m, e)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("File watcher error: %v", err)
+		case now := <-ticker.C:
+			w.flush(m, now.Add(-opts.Debounce))
+		}
+	}
+}
+
+func (w *fileWatcher) handle(m *AuditMonitor, e fsnotify.Event) {
+	now := time.Now()
+	switch {
+	case e.Has(fsnotify.Create):
+		if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+			if w.opts.Recursive {
+				_, err := util.AddDirectory(w.watcher, e.Name, true)
+				if err != nil {
+					log.Warnf("Failed to watch %s: %v", e.Name, err)
+				}
+				w.addDirectoryContents(e.Name, now)
+			}
+			return
+		}
+		p := &pendingFileEvent{eventType: EventTypeCreated}
+		if w.renamed != "" && now.Sub(w.renamedTime) <= w.opts.Debounce {
+			p = &pendingFileEvent{eventType: EventTypeRenamed, oldPath: w.renamed}
+			w.renamed = ""
+		}
+		w.update(e.Name, p, now)
+
+	case e.Has(fsnotify.Write):
+		p, ok := w.pending[e.Name]
+		if !ok {
+			p = &pendingFileEvent{eventType: EventTypeModified}
+		}
+		w.update(e.Name, p, now)
+
+	case e.Has(fsnotify.Remove):
+		w.flushPath(m, e.Name)
+		w.emit(m, EventTypeDeleted, e.Name, FileEventData{})
+
+	case e.Has(fsnotify.Rename):
+		w.flushPath(m, e.Name)
+		w.flushRename(m)
+		w.renamed = e.Name
+		w.renamedTime = now
+	}
+}
+
+// addDirectoryContents reports the files in a new directory as created, since they may have been created (or moved into the directory) before it was watched.
+func (w *fileWatcher) addDirectoryContents(dir string, now time.Time) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Debugf("Failed to read %s: %v", path, err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, ok := w.pending[path]; !ok {
+			w.update(path, &pendingFileEvent{eventType: EventTypeCreated}, now)
+		}
+		return nil
+	})
+}
+
+func (w *fileWatcher) update(path string, p *pendingFileEvent, now time.Time) {
+	p.updated = now
+	w.pending[path] = p
+}
+
+// flush reports the files which haven't changed since before the given time (or all of them if it's zero).
+func (w *fileWatcher) flush(m *AuditMonitor, before time.Time) {
+	for path, p := range w.pending {
+		if before.IsZero() || p.updated.Before(before) {
+			delete(w.pending, path)
+			w.emit(m, p.eventType, path, FileEventData{OldPath: p.oldPath})
+		}
+	}
+	if w.renamed != "" && (before.IsZero() || w.renamedTime.Before(before)) {
+		w.flushRename(m)
+	}
+}
+
+func (w *fileWatcher) flushPath(m *AuditMonitor, path string) {
+	if p, ok := w.pending[path]; ok {
+		delete(w.pending, path)
+		w.emit(m, p.eventType, path, FileEventData{OldPath: p.oldPath})
+	}
+}
+
+// flushRename reports a file which was renamed without a matching create event (i.e. it was moved out of the watched directories).
+func (w *fileWatcher) flushRename(m *AuditMonitor) {
+	if w.renamed == "" {
+		return
+	}
+	w.emit(m, EventTypeRenamed, "", FileEventData{OldPath: w.renamed})
+	w.renamed = ""
+}
+
+// emitAccess reports that a process accessed a file, identifying the process using the process cache.
+func (w *fileWatcher) emitAccess(m *AuditMonitor, eventType EventType, path string, pid int32) {
+	switch eventType {
+	case EventTypeModified:
+		// A process which is writing to a file is only reported once until it closes the file.
+		key := fileAccessKey{pid: pid, path: path}
+		if _, ok := w.modified[key]; ok {
+			return
+		}
+		if len(w.modified) >= ProcessCacheSize {
+			w.modified = make(map[fileAccessKey]struct{})
+		}
+		w.modified[key] = struct{}{}
+	case EventTypeWritten:
+		delete(w.modified, fileAccessKey{pid: pid, path: path})
+	}
+	process, _ := m.processes.Get(pid)
+	w.emit(m, eventType, path, FileEventData{Process: &process})
+}
+
+// hasContents returns true if the contents of a file may have changed (or are of interest) after an event, and so should be hashed and parsed if requested.
+func (w *fileWatcher) hasContents(eventType EventType) bool {
+	switch eventType {
+	case EventTypeCreated, EventTypeRenamed, EventTypeWritten, EventTypeExecuted:
+		return true
+	case EventTypeModified:
+		// fanotify reports a file as modified while it's still being written to.
+		return w.opts.Backend != FileBackendFanotify
+	}
+	return false
+}
+
+// startEmitting starts sending file events to the monitor once their files have been hashed and parsed by the given pool.
+func (w *fileWatcher) startEmitting(ctx context.Context, m *AuditMonitor, pool *hashPool) {
+	w.queue = make(chan queuedFileEvent, EventBufferSize)
+	w.contents = pool
+	w.emitted = make(chan struct{})
+	go func() {
+		defer close(w.emitted)
+		for q := range w.queue {
+			if q.result != nil {
+				r := <-q.result
+				if r.err != nil {
+					log.Debugf("Failed to hash file: %v (path: %s)", r.err, q.file.Path)
+				}
+				q.file.Hashes = r.hashes
+				q.file.ELF = r.elf
+			}
+			m.emitContext(ctx, q.event)
+		}
+	}()
+}
+
+// stopEmitting waits for the queued events to be sent.
+func (w *fileWatcher) stopEmitting() {
+	close(w.queue)
+	<-w.emitted
+}
+
+func (w *fileWatcher) emit(m *AuditMonitor, eventType EventType, path string, data FileEventData) {
+	if !w.matches(path) && (data.OldPath == "" || !w.matches(data.OldPath)) {
+		return
+	}
+	var q queuedFileEvent
+	if path != "" {
+		file := NewFile(path)
+		hash := w.opts.IncludeHashes && w.hasContents(eventType)
+		parseELF := w.opts.IncludeELF && w.hasContents(eventType)
+		if (hash || parseELF) && isRegularFile(path) {
+			ch, err := w.contents.SubmitFile(path, hash, parseELF)
+			if err != nil {
+				log.Warnf("Not hashing file: %v (path: %s)", err, path)
+			}
+			q.result = ch
+		}
+		data.File = &file
+		q.file = &file
+	}
+	log.Debugf("File %s (path: %s)", eventType, path)
+	q.event = NewEvent(ObjectTypeFile, eventType, data)
+	w.queue <- q
+}
+
+// isRegularFile returns true if a path is a regular file, as opposed to e.g. a FIFO, which would block whoever tried to read it, or a symlink.
+func isRegularFile(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
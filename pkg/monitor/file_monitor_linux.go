@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+	"github.com/whitfieldsdad/go-audit/pkg/util"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	fanotifyMetadataLen     = 24 // struct fanotify_event_metadata
+	fanotifyRecvBufferSize  = 64 * 1024
+	fanotifyPollTimeoutMsec = 250
+)
+
+var fanotifyMasks = map[string]uint64{
+	FileAccessOpen:       unix.FAN_OPEN,
+	FileAccessExec:       unix.FAN_OPEN_EXEC,
+	FileAccessModify:     unix.FAN_MODIFY,
+	FileAccessCloseWrite: unix.FAN_CLOSE_WRITE,
+}
+
+// fanotifyEvents are the file access events in the order they're reported in if several of them are merged into one fanotify event.
+var fanotifyEvents = []string{FileAccessOpen, FileAccessExec, FileAccessModify, FileAccessCloseWrite}
+
+type fanotifyEvent struct {
+	Mask uint64
+	Fd   int32
+	PID  int32
+}
+
+// parseFanotifyEvents parses the events read from a fanotify file descriptor (see fanotify(7)).
+func parseFanotifyEvents(b []byte) ([]fanotifyEvent, error) {
+	var events []fanotifyEvent
+	ne := binary.NativeEndian
+	for len(b) >= fanotifyMetadataLen {
+		eventLen := ne.Uint32(b[0:4])
+		if eventLen < fanotifyMetadataLen || int(eventLen) > len(b) {
+			return events, errors.Errorf("malformed fanotify event (length: %d)", eventLen)
+		}
+		if vers := b[4]; vers != unix.FANOTIFY_METADATA_VERSION {
+			return events, errors.Errorf("unsupported fanotify metadata version: %d", vers)
+		}
+		events = append(events, fanotifyEvent{
+			Mask: ne.Uint64(b[8:16]),
+			Fd:   int32(ne.Uint32(b[16:20])),
+			PID:  int32(ne.Uint32(b[20:24])),
+		})
+		b = b[eventLen:]
+	}
+	return events, nil
+}
+
+func (w *fileWatcher) fanotifyMask() uint64 {
+	events := w.opts.Events
+	if len(events) == 0 {
+		events = fanotifyEvents
+	}
+	var mask uint64
+	for _, event := range events {
+		mask |= fanotifyMasks[event]
+	}
+	return mask
+}
+
+// runFanotify reports the files accessed within the watched paths until the context is cancelled.
+func (w *fileWatcher) runFanotify(ctx context.Context, m *AuditMonitor) error {
+	fd, err := unix.FanotifyInit(unix.FAN_CLOEXEC|unix.FAN_CLASS_NOTIF|unix.FAN_NONBLOCK, unix.O_RDONLY|unix.O_LARGEFILE|unix.O_CLOEXEC)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize fanotify (requires CAP_SYS_ADMIN)")
+	}
+	defer unix.Close(fd)
+
+	total, err := w.addFanotifyMarks(fd)
+	if err != nil {
+		return err
+	}
+	log.Infof("Watching %d paths for file access", total)
+
+	self := int32(os.Getpid())
+	buf := make([]byte, fanotifyRecvBufferSize)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for ctx.Err() == nil {
+		n, err := unix.Poll(fds, fanotifyPollTimeoutMsec)
+		if err == unix.EINTR || n == 0 {
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "failed to poll fanotify")
+		}
+		n, err = unix.Read(fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "failed to read fanotify events")
+		}
+		events, err := parseFanotifyEvents(buf[:n])
+		if err != nil {
+			log.Warnf("Failed to parse fanotify events: %v", err)
+		}
+		for _, e := range events {
+			w.handleFanotifyEvent(m, e, self)
+		}
+	}
+	return nil
+}
+
+func (w *fileWatcher) addFanotifyMarks(fd int) (int, error) {
+	mask := w.fanotifyMask()
+	total := 0
+	for _, path := range w.opts.Paths {
+		if w.opts.Mount {
+			err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_MOUNT, mask, unix.AT_FDCWD, path)
+			if err != nil {
+				return total, errors.Wrapf(err, "failed to watch mount: %s", path)
+			}
+			total++
+			continue
+		}
+		// Marking a directory only covers the files directly inside of it, so each subdirectory has to be marked too (subdirectories created later aren't watched).
+		dirs := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() && w.opts.Recursive {
+			dirs = nil
+			for dir := range util.IterSubdirectories(path) {
+				dirs = append(dirs, dir)
+			}
+		}
+		for _, dir := range dirs {
+			err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD, mask|unix.FAN_EVENT_ON_CHILD, unix.AT_FDCWD, dir)
+			if err != nil {
+				return total, errors.Wrapf(err, "failed to watch path: %s", dir)
+			}
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (w *fileWatcher) handleFanotifyEvent(m *AuditMonitor, e fanotifyEvent, self int32) {
+	if e.Mask&unix.FAN_Q_OVERFLOW != 0 {
+		log.Warn("fanotify event queue overflowed, file access events were lost")
+		m.counters.kernelOverflows.Add(1)
+	}
+	if e.Fd == unix.FAN_NOFD {
+		return
+	}
+	path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", e.Fd))
+	unix.Close(int(e.Fd))
+	if err != nil {
+		log.Debugf("Failed to resolve path of file accessed by process %d: %v", e.PID, err)
+		return
+	}
+	// Ignore the files we access ourselves (e.g. when hashing them).
+	if e.PID == self {
+		return
+	}
+	path = strings.TrimSuffix(path, " (deleted)")
+	for _, event := range fanotifyEvents {
+		if e.Mask&fanotifyMasks[event] != 0 {
+			w.emitAccess(m, fileAccessEventTypes[event], path, e.PID)
+		}
+	}
+}
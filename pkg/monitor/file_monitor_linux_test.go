@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseFanotifyEvents(t *testing.T) {
+	var b []byte
+	for _, e := range []fanotifyEvent{
+		{Mask: unix.FAN_MODIFY | unix.FAN_CLOSE_WRITE, Fd: 5, PID: 100},
+		{Mask: unix.FAN_Q_OVERFLOW, Fd: unix.FAN_NOFD, PID: 0},
+	} {
+		event := make([]byte, fanotifyMetadataLen)
+		ne := binary.NativeEndian
+		ne.PutUint32(event[0:4], fanotifyMetadataLen)
+		event[4] = unix.FANOTIFY_METADATA_VERSION
+		ne.PutUint16(event[6:8], fanotifyMetadataLen)
+		ne.PutUint64(event[8:16], e.Mask)
+		ne.PutUint32(event[16:20], uint32(e.Fd))
+		ne.PutUint32(event[20:24], uint32(e.PID))
+		b = append(b, event...)
+	}
+	events, err := parseFanotifyEvents(b)
+	assert.Nil(t, err)
+	assert.Equal(t, []fanotifyEvent{
+		{Mask: unix.FAN_MODIFY | unix.FAN_CLOSE_WRITE, Fd: 5, PID: 100},
+		{Mask: unix.FAN_Q_OVERFLOW, Fd: unix.FAN_NOFD, PID: 0},
+	}, events)
+
+	_, err = parseFanotifyEvents(b[:fanotifyMetadataLen+4])
+	assert.Nil(t, err)
+	b[4] = 1
+	_, err = parseFanotifyEvents(b)
+	assert.NotNil(t, err)
+}
+
+func TestWatchFilesFanotify(t *testing.T) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF, unix.O_RDONLY)
+	if err != nil {
+		t.Skipf("fanotify is unavailable: %v", err)
+	}
+	unix.Close(fd)
+
+	dir := t.TempDir()
+	opts := GetDefaultFileMonitorOptions()
+	opts.Backend = FileBackendFanotify
+	opts.Events = []string{FileAccessCloseWrite}
+	m, _ := newTestFileWatcher(t, dir, opts)
+	m.processes = newProcessCache(ProcessCacheSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.watchFiles(ctx)
+	}()
+
+	// Wait for the marks to be added.
+	time.Sleep(100 * time.Millisecond)
+	path := filepath.Join(dir, "a.txt")
+	cmd := exec.Command("sh", "-c", "echo hello > "+path)
+	assert.Nil(t, cmd.Run())
+
+	select {
+	case e := <-m.Events:
+		assert.Equal(t, EventType(EventTypeWritten), e.Header.EventType)
+		data := e.Data.(FileEventData)
+		assert.Equal(t, path, data.File.Path)
+		assert.NotNil(t, data.File.Hashes)
+		assert.Equal(t, int32(cmd.Process.Pid), data.Process.PID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for file event")
+	}
+	cancel()
+	<-done
+}
+
+func TestFileWatcherContents(t *testing.T) {
+	dir := t.TempDir()
+	opts := GetDefaultFileMonitorOptions()
+	opts.IncludeELF = true
+	m, w := newTestFileWatcher(t, dir, opts)
+	startTestFileEmitter(t, m, w)
+
+	// Reading a FIFO blocks until something writes to it, so only regular files are hashed and parsed.
+	fifo := filepath.Join(dir, "fifo")
+	assert.Nil(t, unix.Mkfifo(fifo, 0o600))
+	b, err := os.ReadFile("/bin/true")
+	assert.Nil(t, err)
+	executable := filepath.Join(dir, "true")
+	assert.Nil(t, os.WriteFile(executable, b, 0o700))
+	w.handle(m, fsnotify.Event{Name: fifo, Op: fsnotify.Create})
+	w.handle(m, fsnotify.Event{Name: executable, Op: fsnotify.Create})
+	w.flush(m, time.Time{})
+
+	files := make(map[string]*File)
+	for _, e := range readFileEvents(m, w) {
+		file := e.Data.(FileEventData).File
+		files[file.Path] = file
+	}
+	assert.Len(t, files, 2)
+	assert.Nil(t, files[fifo].Hashes)
+	assert.Nil(t, files[fifo].ELF)
+	assert.NotNil(t, files[executable].Hashes)
+	assert.NotNil(t, files[executable].ELF)
+}
+
+func TestFanotifyOverflow(t *testing.T) {
+	opts := GetDefaultFileMonitorOptions()
+	opts.Backend = FileBackendFanotify
+	m, w := newTestFileWatcher(t, t.TempDir(), opts)
+
+	// An overflow is counted in the telemetry, since the events which were lost are never reported.
+	w.handleFanotifyEvent(m, fanotifyEvent{Mask: unix.FAN_Q_OVERFLOW, Fd: unix.FAN_NOFD}, int32(os.Getpid()))
+	assert.Equal(t, uint64(1), m.GetTelemetry().KernelOverflows)
+	assert.Empty(t, readEvents(m))
+}
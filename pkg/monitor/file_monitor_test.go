@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/whitfieldsdad/go-audit/pkg/util"
+)
+
+func newTestFileWatcher(t *testing.T, dir string, opts *FileMonitorOptions) (*AuditMonitor, *fileWatcher) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	opts.Paths = []string{dir}
+	w, err := newFileWatcher(opts)
+	assert.Nil(t, err)
+	m.Options.Files = opts
+	m.files = w
+	return m, w
+}
+
+// startTestFileEmitter sends the events emitted by a watcher which isn't running, so that its handle and flush methods can be called directly.
+func startTestFileEmitter(t *testing.T, m *AuditMonitor, w *fileWatcher) {
+	pool := newHashPool(1, EventBufferSize, m.Options.HashOptions)
+	w.startEmitting(context.Background(), m, pool)
+	t.Cleanup(func() {
+		w.stopEmitting()
+		pool.Close()
+	})
+}
+
+// readFileEvents waits for the events queued by a watcher to be sent, and returns them.
+func readFileEvents(m *AuditMonitor, w *fileWatcher) []Event {
+	w.stopEmitting()
+	events := readEvents(m)
+	w.startEmitting(context.Background(), m, w.contents)
+	return events
+}
+
+func TestFileWatcherDebounce(t *testing.T) {
+	dir := t.TempDir()
+	m, w := newTestFileWatcher(t, dir, GetDefaultFileMonitorOptions())
+	startTestFileEmitter(t, m, w)
+	path := filepath.Join(dir, "a.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("hello"), 0o600))
+
+	// A file which is created and then written to is only reported once, as created.
+	w.handle(m, fsnotify.Event{Name: path, Op: fsnotify.Create})
+	w.handle(m, fsnotify.Event{Name: path, Op: fsnotify.Write})
+	w.handle(m, fsnotify.Event{Name: path, Op: fsnotify.Write})
+	w.flush(m, time.Now().Add(-time.Minute))
+	assert.Empty(t, readFileEvents(m, w))
+	w.flush(m, time.Now().Add(time.Second))
+	events := readFileEvents(m, w)
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventType(EventTypeCreated), events[0].Header.EventType)
+	data := events[0].Data.(FileEventData)
+	assert.Equal(t, path, data.File.Path)
+	assert.NotNil(t, data.File.Hashes)
+
+	// A pending change is reported before the file is deleted.
+	w.handle(m, fsnotify.Event{Name: path, Op: fsnotify.Write})
+	w.handle(m, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+	events = readFileEvents(m, w)
+	assert.Len(t, events, 2)
+	assert.Equal(t, EventType(EventTypeModified), events[0].Header.EventType)
+	assert.Equal(t, EventType(EventTypeDeleted), events[1].Header.EventType)
+	assert.Nil(t, events[1].Data.(FileEventData).File.Hashes)
+}
+
+func TestFileWatcherRename(t *testing.T) {
+	dir := t.TempDir()
+	m, w := newTestFileWatcher(t, dir, GetDefaultFileMonitorOptions())
+	startTestFileEmitter(t, m, w)
+	oldPath := filepath.Join(dir, "a.txt")
+	newPath := filepath.Join(dir, "b.txt")
+	assert.Nil(t, os.WriteFile(newPath, []byte("hello"), 0o600))
+
+	w.handle(m, fsnotify.Event{Name: oldPath, Op: fsnotify.Rename})
+	w.handle(m, fsnotify.Event{Name: newPath, Op: fsnotify.Create})
+	w.flush(m, time.Time{})
+	events := readFileEvents(m, w)
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventType(EventTypeRenamed), events[0].Header.EventType)
+	data := events[0].Data.(FileEventData)
+	assert.Equal(t, oldPath, data.OldPath)
+	assert.Equal(t, newPath, data.File.Path)
+
+	// A file which is moved out of the watched directories has no new path.
+	w.handle(m, fsnotify.Event{Name: newPath, Op: fsnotify.Rename})
+	w.flush(m, time.Time{})
+	events = readFileEvents(m, w)
+	assert.Len(t, events, 1)
+	data = events[0].Data.(FileEventData)
+	assert.Equal(t, newPath, data.OldPath)
+	assert.Nil(t, data.File)
+}
+
+func TestFileWatcherGlobs(t *testing.T) {
+	dir := t.TempDir()
+	opts := GetDefaultFileMonitorOptions()
+	opts.Include = []string{"**.conf"}
+	opts.Exclude = []string{"**/cache/**"}
+	m, w := newTestFileWatcher(t, dir, opts)
+	startTestFileEmitter(t, m, w)
+	for _, path := range []string{
+		filepath.Join(dir, "a.conf"),
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "cache", "b.conf"),
+	} {
+		w.handle(m, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+	}
+	events := readFileEvents(m, w)
+	assert.Len(t, events, 1)
+	assert.Equal(t, filepath.Join(dir, "a.conf"), events[0].Data.(FileEventData).File.Path)
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	opts := GetDefaultFileMonitorOptions()
+	opts.Debounce = 50 * time.Millisecond
+	m, _ := newTestFileWatcher(t, dir, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.watchFiles(ctx)
+	}()
+
+	// Wait for the watcher to be added.
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	time.Sleep(100 * time.Millisecond)
+	path := filepath.Join(dir, "sub", "a.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("hello"), 0o600))
+
+	select {
+	case e := <-m.Events:
+		assert.Equal(t, EventType(EventTypeCreated), e.Header.EventType)
+		assert.Equal(t, path, e.Data.(FileEventData).File.Path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for file event")
+	}
+	cancel()
+	<-done
+}
+
+func TestFileWatcherNewDirectory(t *testing.T) {
+	dir := t.TempDir()
+	m, w := newTestFileWatcher(t, dir, GetDefaultFileMonitorOptions())
+	startTestFileEmitter(t, m, w)
+	var err error
+	w.watcher, err = fsnotify.NewWatcher()
+	assert.Nil(t, err)
+	defer w.watcher.Close()
+
+	// The files in a directory which was moved into a watched directory are reported as created.
+	sub := filepath.Join(dir, "sub")
+	assert.Nil(t, os.MkdirAll(filepath.Join(sub, "nested"), 0o700))
+	paths := []string{filepath.Join(sub, "a.txt"), filepath.Join(sub, "nested", "b.txt")}
+	for _, path := range paths {
+		assert.Nil(t, os.WriteFile(path, []byte("hello"), 0o600))
+	}
+	w.handle(m, fsnotify.Event{Name: sub, Op: fsnotify.Create})
+	assert.Contains(t, w.watcher.WatchList(), filepath.Join(sub, "nested"))
+
+	w.flush(m, time.Time{})
+	var created []string
+	for _, e := range readFileEvents(m, w) {
+		assert.Equal(t, EventType(EventTypeCreated), e.Header.EventType)
+		created = append(created, e.Data.(FileEventData).File.Path)
+	}
+	assert.ElementsMatch(t, paths, created)
+
+	// A directory which doesn't exist can't be watched.
+	_, err = util.AddDirectory(w.watcher, filepath.Join(dir, "missing"), true)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,11 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+func (w *fileWatcher) runFanotify(ctx context.Context, m *AuditMonitor) error {
+	return errors.New("the fanotify backend is only supported on Linux")
+}
@@ -0,0 +1,10 @@
+package monitor
+
+import (
+	"os"
+)
+
+// getFileId isn't implemented on Windows, since os.FileInfo doesn't include the volume serial number or file index.
+func getFileId(info os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+)
+
+var (
+	HashCacheSize = 4096
+)
+
+// fileKey identifies a version of a file without reading it (i.e. a file is assumed not to have changed if its device, inode, size, and modification time haven't changed).
+type fileKey struct {
+	dev   uint64
+	ino   uint64
+	size  int64
+	mtime int64
+}
+
+func getFileKey(path string) (*fileKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	k := &fileKey{
+		size:  info.Size(),
+		mtime: info.ModTime().UnixNano(),
+	}
+	k.dev, k.ino = getFileId(info)
+	return k, nil
+}
+
+var (
+	hashCache     *lru.Cache
+	hashCacheOnce sync.Once
+)
+
+func getHashCache() *lru.Cache {
+	hashCacheOnce.Do(func() {
+		var err error
+		hashCache, err = lru.New(HashCacheSize)
+		if err != nil {
+			log.Fatalf("Failed to create hash cache: %v", err)
+		}
+	})
+	return hashCache
+}
+
+type hashCacheKey struct {
+	file fileKey
+	opts string
+}
+
+// GetCachedFileHashes returns the hashes of a file, only reading the file if it has changed since it was last hashed.
+func GetCachedFileHashes(path string, opts *HashOptions) (*Hashes, error) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
+	k, err := getFileKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if k.ino == 0 {
+		// Without an inode we can't tell whether the file has changed.
+		return GetFileHashesWithOptions(path, opts)
+	}
+	cache := getHashCache()
+	key := hashCacheKey{file: *k, opts: opts.key()}
+	if v, ok := cache.Get(key); ok {
+		return v.(*Hashes), nil
+	}
+	hashes, err := GetFileHashesWithOptions(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	cache.Add(key, hashes)
+	return hashes, nil
+}
+
+// getCachedFileHashes returns the hashes of a file if they've already been calculated.
+func getCachedFileHashes(path string, opts *HashOptions) (*Hashes, bool) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
+	k, err := getFileKey(path)
+	if err != nil || k.ino == 0 {
+		return nil, false
+	}
+	v, ok := getHashCache().Get(hashCacheKey{file: *k, opts: opts.key()})
+	if !ok {
+		return nil, false
+	}
+	return v.(*Hashes), true
+}
+
+type hashResult struct {
+	hashes *Hashes
+	err    error
+
+	// elf is only set if the file was parsed as well (see SubmitFile).
+	elf *ELF
+}
+
+type hashJob struct {
+	path     string
+	hash     bool
+	parseELF bool
+	result   chan hashResult
+}
+
+// hashPool hashes files asynchronously using a fixed number of workers and a bounded queue.
+type hashPool struct {
+	jobs chan hashJob
+	opts *HashOptions
+}
+
+func newHashPool(workers, queueSize int, opts *HashOptions) *hashPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &hashPool{
+		jobs: make(chan hashJob, queueSize),
+		opts: opts,
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *hashPool) work() {
+	for job := range p.jobs {
+		var r hashResult
+		if job.hash {
+			r.hashes, r.err = GetCachedFileHashes(job.path, p.opts)
+		}
+		if job.parseELF {
+			// Most files aren't ELF files.
+			r.elf, _ = GetCachedELF(job.path, p.opts)
+		}
+		job.result <- r
+	}
+}
+
+// Submit queues a file to be hashed, or returns an error if the queue is full.
+func (p *hashPool) Submit(path string) (<-chan hashResult, error) {
+	return p.SubmitFile(path, true, false)
+}
+
+// SubmitFile queues a file to be hashed and/or have its ELF metadata parsed, or returns an error if the queue is full.
+func (p *hashPool) SubmitFile(path string, hash, parseELF bool) (<-chan hashResult, error) {
+	job := hashJob{
+		path:     path,
+		hash:     hash,
+		parseELF: parseELF,
+		result:   make(chan hashResult, 1),
+	}
+	select {
+	case p.jobs <- job:
+		return job.result, nil
+	default:
+		return nil, errors.New("hash queue is full")
+	}
+}
+
+func (p *hashPool) Close() {
+	close(p.jobs)
+}
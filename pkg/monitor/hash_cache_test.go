@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCachedFileHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exe")
+	assert.Nil(t, os.WriteFile(path, []byte("a"), 0755))
+
+	a, err := GetCachedFileHashes(path, nil)
+	assert.Nil(t, err)
+	b, ok := getCachedFileHashes(path, nil)
+	assert.True(t, ok)
+	assert.Same(t, a, b)
+
+	// Replacing the file invalidates the cache.
+	assert.Nil(t, os.WriteFile(path, []byte("bb"), 0755))
+	_, ok = getCachedFileHashes(path, nil)
+	assert.False(t, ok)
+	c, err := GetCachedFileHashes(path, nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, a.SHA256, c.SHA256)
+}
+
+func TestEmitProcessEventEnriched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exe")
+	assert.Nil(t, os.WriteFile(path, []byte("enriched"), 0755))
+
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.hashes = newHashPool(1, 1, nil)
+	defer m.hashes.Close()
+
+	exe := NewFile(path)
+	m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 1, Executable: &exe}}))
+
+	started := <-m.Events
+	assert.Nil(t, started.Data.(ProcessStartEventData).Executable.Hashes)
+
+	select {
+	case enriched := <-m.Events:
+		assert.Equal(t, EventType(EventTypeEnriched), enriched.Header.EventType)
+		data := enriched.Data.(ProcessEnrichEventData)
+		assert.Equal(t, int32(1), data.PID)
+		assert.NotEmpty(t, data.Executable.Hashes.SHA256)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for enriched event")
+	}
+
+	// Now that the file has been hashed, the hashes are included in the started event.
+	m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 2, Executable: &exe}}))
+	started = <-m.Events
+	assert.NotNil(t, started.Data.(ProcessStartEventData).Executable.Hashes)
+	assert.Nil(t, exe.Hashes)
+}
+
+func TestEmitProcessEventEnrichedAfterStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exe")
+	assert.Nil(t, os.WriteFile(path, []byte("stopped"), 0755))
+
+	m := newTestAuditMonitor(t, OverflowBlock, 1)
+	m.hashes = newHashPool(1, 1, nil)
+	defer m.hashes.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.ctx = ctx
+
+	// Nothing reads the enriched event, which is dropped once the monitor has stopped rather than blocking forever.
+	exe := NewFile(path)
+	m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 1, Executable: &exe}}))
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		m.enrichers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the enricher to stop")
+	}
+	assert.Len(t, m.Events, 1)
+}
+
+func TestEmitProcessEventModules(t *testing.T) {
+	dir := t.TempDir()
+	exe := NewFile(filepath.Join(dir, "exe"))
+	var modules []Module
+	for _, name := range []string{"liba.so", "libb.so", "libc.so"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(name), 0755))
+		modules = append(modules, Module{File: NewFile(path)})
+	}
+	modules[2].Deleted = true
+	assert.Nil(t, os.WriteFile(exe.Path, []byte("modules"), 0755))
+	_, err := GetCachedFileHashes(exe.Path, nil)
+	assert.Nil(t, err)
+
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.hashes = newHashPool(1, 2, nil)
+	defer m.hashes.Close()
+
+	// The executable has already been hashed, but the modules are hashed in the background.
+	m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 1, Executable: &exe, Modules: modules}}))
+	started := (<-m.Events).Data.(ProcessStartEventData)
+	assert.NotNil(t, started.Executable.Hashes)
+	assert.Len(t, started.Modules, 3)
+
+	select {
+	case enriched := <-m.Events:
+		assert.Equal(t, EventType(EventTypeEnriched), enriched.Header.EventType)
+		data := enriched.Data.(ProcessEnrichEventData)
+		assert.Nil(t, data.Executable)
+		assert.Len(t, data.Modules, 3)
+		assert.NotNil(t, data.Modules[0].Hashes)
+		assert.NotNil(t, data.Modules[1].Hashes)
+		assert.Nil(t, data.Modules[2].Hashes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for enriched event")
+	}
+	for _, module := range append(started.Modules, modules...) {
+		assert.Nil(t, module.Hashes)
+	}
+}
+
+func TestEmitProcessEventELF(t *testing.T) {
+	b, err := os.ReadFile("/bin/true")
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "true")
+	assert.Nil(t, os.WriteFile(path, b, 0755))
+
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.Options.IncludeHashes = false
+	m.Options.IncludeELF = true
+	assert.True(t, m.getNewProcessOptions().IncludeELF)
+	m.hashes = newHashPool(1, 1, nil)
+	defer m.hashes.Close()
+
+	// Executables are parsed by the hash pool rather than while the process is being read.
+	assert.False(t, m.getNewProcessOptions().IncludeELF)
+	assert.True(t, m.getProcessOptions().IncludeELF)
+
+	exe := NewFile(path)
+	m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 1, Executable: &exe}}))
+	started := (<-m.Events).Data.(ProcessStartEventData)
+	assert.Nil(t, started.Executable.ELF)
+
+	select {
+	case enriched := <-m.Events:
+		data := enriched.Data.(ProcessEnrichEventData)
+		assert.NotNil(t, data.Executable.ELF)
+		assert.Nil(t, data.Executable.Hashes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for enriched event")
+	}
+}
+
+func TestEmitModuleLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "libx.so")
+	assert.Nil(t, os.WriteFile(path, []byte("loaded"), 0755))
+
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.hashes = newHashPool(1, 1, nil)
+	defer m.hashes.Close()
+
+	// The event is sent once the module has been hashed by the hash pool.
+	data := ProcessModuleLoadEventData{PID: 1, Module: Module{File: NewFile(path)}}
+	m.emitModuleLoad(data)
+	select {
+	case e := <-m.Events:
+		assert.Equal(t, EventType(EventTypeModuleLoaded), e.Header.EventType)
+		assert.NotNil(t, e.Data.(ProcessModuleLoadEventData).Module.Hashes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for module loaded event")
+	}
+
+	// Modules which have already been hashed are sent straight away.
+	m.emitModuleLoad(data)
+	assert.Len(t, m.Events, 1)
+	assert.NotNil(t, (<-m.Events).Data.(ProcessModuleLoadEventData).Module.Hashes)
+}
@@ -5,53 +5,193 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/zeebo/xxh3"
+	"lukechampine.com/blake3"
+)
+
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashBLAKE3 = "blake3"
+	HashCRC32  = "crc32"
+	HashXXH3   = "xxh3"
+)
+
+const (
+	// HashModeFull means that the whole file was hashed.
+	HashModeFull = "full"
+
+	// HashModeHeadTail means that only the first and last HashOptions.PartialSize bytes of the file were hashed.
+	HashModeHeadTail = "head+tail"
 )
 
 type Hashes struct {
 	MD5    string `json:"md5,omitempty"`
 	SHA1   string `json:"sha1,omitempty"`
 	SHA256 string `json:"sha256,omitempty"`
+	SHA512 string `json:"sha512,omitempty"`
+	BLAKE3 string `json:"blake3,omitempty"`
+	CRC32  string `json:"crc32,omitempty"`
 	XXH3   uint64 `json:"xxh3,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+}
+
+type HashOptions struct {
+	Algorithms []string `json:"algorithms"`
+
+	// MaxSize is the size in bytes above which only the head and tail of a file are hashed (0 = no limit).
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	// PartialSize is the number of bytes hashed from both the head and the tail of files larger than MaxSize.
+	PartialSize int64 `json:"partial_size,omitempty"`
+}
+
+func GetDefaultHashOptions() *HashOptions {
+	return &HashOptions{
+		Algorithms:  []string{HashMD5, HashSHA1, HashSHA256, HashXXH3},
+		PartialSize: 4 * 1024 * 1024,
+	}
+}
+
+// Validate checks that all of the algorithms are supported.
+func (o *HashOptions) Validate() error {
+	if len(o.Algorithms) == 0 {
+		return errors.New("no hash algorithms selected")
+	}
+	for _, a := range o.Algorithms {
+		_, err := newHash(a)
+		if err != nil {
+			return err
+		}
+	}
+	if o.MaxSize > 0 && o.PartialSize <= 0 {
+		return errors.New("partial size must be greater than 0 if a maximum size is set")
+	}
+	return nil
+}
+
+// key uniquely identifies the options for caching purposes.
+func (o *HashOptions) key() string {
+	return fmt.Sprintf("%s,%d,%d", strings.ToLower(strings.Join(o.Algorithms, ",")), o.MaxSize, o.PartialSize)
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case HashMD5:
+		return md5.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	case HashBLAKE3:
+		return blake3.New(32, nil), nil
+	case HashCRC32:
+		return crc32.NewIEEE(), nil
+	case HashXXH3:
+		return xxh3.New(), nil
+	}
+	return nil, errors.Errorf("unsupported hash algorithm: %s", algorithm)
 }
 
 func (h *Hashes) Empty() bool {
-	return h.MD5 == "" && h.SHA1 == "" && h.SHA256 == ""
+	return h.MD5 == "" && h.SHA1 == "" && h.SHA256 == "" && h.SHA512 == "" && h.BLAKE3 == "" && h.CRC32 == "" && h.XXH3 == 0
 }
 
 func GetHashes(rd io.Reader) (*Hashes, error) {
-	md5h := md5.New()
-	sha1h := sha1.New()
-	sha256h := sha256.New()
-	xxh3h := xxh3.New()
+	return GetHashesWithOptions(rd, nil)
+}
+
+func GetHashesWithOptions(rd io.Reader, opts *HashOptions) (*Hashes, error) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
+	hashers := make(map[string]hash.Hash, len(opts.Algorithms))
+	writers := make([]io.Writer, 0, len(opts.Algorithms))
+	for _, a := range opts.Algorithms {
+		h, err := newHash(a)
+		if err != nil {
+			return nil, err
+		}
+		hashers[strings.ToLower(a)] = h
+		writers = append(writers, h)
+	}
 
 	pagesize := os.Getpagesize()
 	reader := bufio.NewReaderSize(rd, pagesize)
-	multiWriter := io.MultiWriter(md5h, sha1h, sha256h, xxh3h)
+	multiWriter := io.MultiWriter(writers...)
 	_, err := io.Copy(multiWriter, reader)
 	if err != nil {
 		return nil, err
 	}
 	hashes := &Hashes{
-		MD5:    fmt.Sprintf("%x", md5h.Sum(nil)),
-		SHA1:   fmt.Sprintf("%x", sha1h.Sum(nil)),
-		SHA256: fmt.Sprintf("%x", sha256h.Sum(nil)),
-		XXH3:   xxh3h.Sum64(),
+		Mode: HashModeFull,
+	}
+	for a, h := range hashers {
+		digest := fmt.Sprintf("%x", h.Sum(nil))
+		switch a {
+		case HashMD5:
+			hashes.MD5 = digest
+		case HashSHA1:
+			hashes.SHA1 = digest
+		case HashSHA256:
+			hashes.SHA256 = digest
+		case HashSHA512:
+			hashes.SHA512 = digest
+		case HashBLAKE3:
+			hashes.BLAKE3 = digest
+		case HashCRC32:
+			hashes.CRC32 = digest
+		case HashXXH3:
+			hashes.XXH3 = h.(*xxh3.Hasher).Sum64()
+		}
 	}
 	return hashes, nil
 }
 
 func GetFileHashes(path string) (*Hashes, error) {
+	return GetFileHashesWithOptions(path, nil)
+}
+
+// GetFileHashesWithOptions hashes a file, only hashing its head and tail if it's larger than the maximum size.
+func GetFileHashesWithOptions(path string, opts *HashOptions) (*Hashes, error) {
+	if opts == nil {
+		opts = GetDefaultHashOptions()
+	}
 	f, err := os.OpenFile(path, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return GetHashes(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if opts.MaxSize <= 0 || size <= opts.MaxSize || size <= 2*opts.PartialSize {
+		return GetHashesWithOptions(f, opts)
+	}
+	head := io.NewSectionReader(f, 0, opts.PartialSize)
+	tail := io.NewSectionReader(f, size-opts.PartialSize, opts.PartialSize)
+	hashes, err := GetHashesWithOptions(io.MultiReader(head, tail), opts)
+	if err != nil {
+		return nil, err
+	}
+	hashes.Mode = HashModeHeadTail
+	return hashes, nil
 }
 
 func GetXXH3(data []byte) uint64 {
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHashesWithOptions(t *testing.T) {
+	opts := &HashOptions{Algorithms: []string{HashSHA512, HashBLAKE3, HashCRC32}}
+	hashes, err := GetHashesWithOptions(bytes.NewReader([]byte("abc")), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f", hashes.SHA512)
+	assert.Equal(t, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", hashes.BLAKE3)
+	assert.Equal(t, "352441c2", hashes.CRC32)
+	assert.Equal(t, HashModeFull, hashes.Mode)
+	assert.Empty(t, hashes.MD5)
+	assert.Empty(t, hashes.SHA256)
+}
+
+func TestGetFileHashesHeadTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large")
+	data := bytes.Repeat([]byte("a"), 100)
+	copy(data[40:], "middle")
+	assert.Nil(t, os.WriteFile(path, data, 0644))
+
+	opts := &HashOptions{Algorithms: []string{HashSHA256}, MaxSize: 50, PartialSize: 10}
+	hashes, err := GetFileHashesWithOptions(path, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, HashModeHeadTail, hashes.Mode)
+
+	// Only the head and tail are hashed, so changes to the middle of the file aren't detected.
+	expected, err := GetHashesWithOptions(bytes.NewReader(bytes.Repeat([]byte("a"), 20)), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, expected.SHA256, hashes.SHA256)
+}
+
+func TestHashOptionsValidate(t *testing.T) {
+	assert.Nil(t, GetDefaultHashOptions().Validate())
+	assert.NotNil(t, (&HashOptions{}).Validate())
+	assert.NotNil(t, (&HashOptions{Algorithms: []string{"md4"}}).Validate())
+	assert.NotNil(t, (&HashOptions{Algorithms: []string{HashMD5}, MaxSize: 10}).Validate())
+}
+
+func TestHashOptionsKey(t *testing.T) {
+	a := &HashOptions{Algorithms: []string{"SHA256"}}
+	b := &HashOptions{Algorithms: []string{HashSHA256}}
+	assert.Equal(t, a.key(), b.key())
+	b.MaxSize = 10
+	assert.NotEqual(t, a.key(), b.key())
+}
@@ -1,11 +1,15 @@
 package monitor
 
 import (
+	"net"
 	"os"
 	"runtime"
+	"sync"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/denisbrodbeck/machineid"
+	"github.com/shirou/gopsutil/v3/host"
 )
 
 const (
@@ -34,7 +38,7 @@ func GetHost() Host {
 	id := GetHostId()
 	hostname, err := os.Hostname()
 	if err != nil {
-		log.Warnf("Failed to get hostname: %s", hostname)
+		log.Warnf("Failed to get hostname: %v", err)
 	}
 	return Host{
 		Id:       id,
@@ -43,15 +47,87 @@ func GetHost() Host {
 	}
 }
 
-var _hostId string
+var (
+	hostId     string
+	hostIdOnce sync.Once
+)
 
+// GetHostId returns an identifier for the host which is derived from its machine ID, or from its hostname if the machine ID can't be read.
 func GetHostId() string {
-	if _hostId == "" {
-		id, err := machineid.ID()
-		if err != nil {
-			log.Fatalf("Failed to get host ID")
+	hostIdOnce.Do(func() {
+		hostId = getHostId(machineid.ID, os.Hostname)
+	})
+	return hostId
+}
+
+func getHostId(machineId, hostname func() (string, error)) string {
+	id, err := machineId()
+	if err == nil {
+		return NewUUID5(appId, []byte(id))
+	}
+	name, hostnameErr := hostname()
+	if hostnameErr != nil {
+		log.Warnf("Failed to get host ID: %v (hostname: %v)", err, hostnameErr)
+	} else {
+		log.Warnf("Failed to get host ID, using the hostname instead: %v", err)
+	}
+	return NewUUID5(appId, []byte(name))
+}
+
+// HostInventory describes a host in more detail than Host, and is periodically emitted by the monitor (see AuditMonitorOptions.HostInventoryInterval).
+type HostInventory struct {
+	Host
+	KernelVersion string     `json:"kernel_version,omitempty"`
+	BootTime      *time.Time `json:"boot_time,omitempty"`
+
+	// BootId is a random identifier which changes every time the host is booted (e.g. to tell apart processes with the same PID and create time on different boots).
+	BootId      string   `json:"boot_id,omitempty"`
+	IPAddresses []string `json:"ip_addresses,omitempty"`
+}
+
+func GetHostInventory() HostInventory {
+	inv := HostInventory{
+		Host: GetHost(),
+	}
+	var err error
+	inv.KernelVersion, err = host.KernelVersion()
+	if err != nil {
+		log.Debugf("Failed to get kernel version: %v", err)
+	}
+	bootTime, err := getBootTime()
+	if err == nil {
+		inv.BootTime = &bootTime
+	} else {
+		log.Debugf("Failed to get boot time: %v", err)
+	}
+	inv.BootId, err = getBootId()
+	if err != nil {
+		log.Debugf("Failed to get boot ID: %v", err)
+	}
+	inv.IPAddresses, err = getIPAddresses()
+	if err != nil {
+		log.Debugf("Failed to get IP addresses: %v", err)
+	}
+	return inv
+}
+
+// getIPAddresses returns the IP addresses of the host, excluding loopback and link-local addresses.
+func getIPAddresses() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			continue
 		}
-		_hostId = NewUUID5(appId, []byte(id))
+		ips = append(ips, ip.String())
 	}
-	return _hostId
+	return ips, nil
 }
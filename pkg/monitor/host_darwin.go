@@ -0,0 +1,20 @@
+package monitor
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+func getBootId() (string, error) {
+	return syscall.Sysctl("kern.bootsessionuuid")
+}
+
+func getBootTime() (time.Time, error) {
+	bootTime, err := host.BootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(bootTime), 0), nil
+}
@@ -0,0 +1,15 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func getBootId() (string, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, "sys", "kernel", "random", "boot_id"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
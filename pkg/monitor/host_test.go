@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHostInventory(t *testing.T) {
+	inv := GetHostInventory()
+	assert.Equal(t, GetHostId(), inv.Id)
+	assert.NotEmpty(t, inv.KernelVersion)
+	assert.NotNil(t, inv.BootTime)
+}
+
+func TestEmitIncludesHost(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 1)
+	host := GetHost()
+	m.host = &host
+
+	m.emit(newTestEvent(1))
+	e := <-m.Events
+	assert.Equal(t, GetHostId(), e.Header.HostId)
+	assert.Equal(t, host.Hostname, e.Header.Host.Hostname)
+}
+
+func TestGetHostId(t *testing.T) {
+	machineId := func() (string, error) { return "machine", nil }
+	noMachineId := func() (string, error) { return "", errors.New("no machine ID") }
+	hostname := func() (string, error) { return "host", nil }
+	noHostname := func() (string, error) { return "", errors.New("no hostname") }
+
+	// The hostname is only used if there's no machine ID.
+	id := getHostId(machineId, hostname)
+	assert.Equal(t, NewUUID5(appId, []byte("machine")), id)
+	fallback := getHostId(noMachineId, hostname)
+	assert.Equal(t, NewUUID5(appId, []byte("host")), fallback)
+	assert.NotEqual(t, id, fallback)
+	assert.NotEmpty(t, getHostId(noMachineId, noHostname))
+}
+
+func TestGetHostIdConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	ids := make([]string, 8)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = NewEvent(ObjectTypeMonitor, EventTypeTelemetry, nil).Header.HostId
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		assert.Equal(t, GetHostId(), id)
+	}
+}
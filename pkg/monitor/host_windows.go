@@ -0,0 +1,20 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+func getBootId() (string, error) {
+	return "", errors.New("not supported on Windows")
+}
+
+func getBootTime() (time.Time, error) {
+	bootTime, err := host.BootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(bootTime), 0), nil
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Module is a shared library mapped into the address space of a process.
+type Module struct {
+	File
+	BaseAddress uint64 `json:"base_address"`
+
+	// Deleted is set if the file has been deleted (or replaced) since it was mapped (e.g. a memfd: file), in which case it's hashed through /proc/<pid>/map_files (requires CAP_SYS_ADMIN).
+	Deleted bool `json:"deleted,omitempty"`
+
+	// mapFile is the path of a deleted file in /proc/<pid>/map_files.
+	mapFile string
+}
+
+// hashPath returns the path to read the module from when hashing it, or an empty string if it can't be read.
+func (m Module) hashPath() string {
+	if m.Deleted {
+		return m.mapFile
+	}
+	return m.Path
+}
+
+type ProcessModuleLoadEventData struct {
+	GUID   string `json:"guid,omitempty"`
+	PID    int32  `json:"pid"`
+	Name   string `json:"name,omitempty"`
+	Module Module `json:"module"`
+}
+
+// hashModules hashes the modules of a process, using the hash cache so that commonly used libraries (e.g. libc) are only read once.
+func hashModules(modules []Module, opts *HashOptions) {
+	for i := range modules {
+		path := modules[i].hashPath()
+		if path == "" || modules[i].Hashes != nil {
+			continue
+		}
+		hashes, err := GetCachedFileHashes(path, opts)
+		if err != nil {
+			log.Debugf("Failed to hash module: %v (path: %s)", err, modules[i].Path)
+			continue
+		}
+		modules[i].Hashes = hashes
+	}
+}
+
+// processModules are the files which a running process has been seen to map (including files which aren't modules).
+type processModules struct {
+	pid     int32
+	name    string
+	matched bool
+	paths   map[string]struct{}
+}
+
+// moduleTracker finds the modules which are loaded by running processes (e.g. using dlopen) by periodically comparing the modules each process has mapped.
+type moduleTracker struct {
+	processes map[string]*processModules
+}
+
+func newModuleTracker() *moduleTracker {
+	return &moduleTracker{
+		processes: make(map[string]*processModules),
+	}
+}
+
+// scan returns the modules which have been loaded by each matching process since the previous scan. The modules of a process which hasn't been seen before aren't reported, since they're included in its started event (see AuditMonitorOptions.IncludeModules).
+func (t *moduleTracker) scan(m *AuditMonitor) ([]ProcessModuleLoadEventData, error) {
+	ids, err := listProcessIdentities()
+	if err != nil {
+		return nil, err
+	}
+	tree := NewProcessTreeFromProcessIdentities(ids)
+	running := make(map[string]struct{}, len(ids))
+	var loaded []ProcessModuleLoadEventData
+	for _, id := range ids {
+		guid := id.GUID()
+		if guid == "" {
+			continue
+		}
+		running[guid] = struct{}{}
+		name, err := getProcessName(id.PID)
+		if err != nil {
+			continue
+		}
+
+		// A process which has called execve maps a new set of modules (which are included in its started event), so it's treated as a new process.
+		p, known := t.processes[guid]
+		known = known && name == p.name
+		if !known {
+			p = &processModules{
+				pid:     id.PID,
+				name:    name,
+				matched: m.matchesRunningProcess(id, tree),
+				paths:   make(map[string]struct{}),
+			}
+			t.processes[guid] = p
+		}
+		if !p.matched {
+			continue
+		}
+
+		// Only the files which haven't been seen in the process before are checked.
+		modules, err := getProcessModules(id.PID, p.paths)
+		if err != nil {
+			continue
+		}
+		if !known {
+			continue
+		}
+		for _, module := range modules {
+			loaded = append(loaded, ProcessModuleLoadEventData{
+				GUID:   guid,
+				PID:    id.PID,
+				Name:   p.name,
+				Module: module,
+			})
+		}
+	}
+	for guid := range t.processes {
+		if _, ok := running[guid]; !ok {
+			delete(t.processes, guid)
+		}
+	}
+	return loaded, nil
+}
+
+// pollModules emits a module loaded event each time a running process maps a new module, checking every ModuleInterval until the context is cancelled.
+func (m *AuditMonitor) pollModules(ctx context.Context) {
+	t := newModuleTracker()
+	_, err := t.scan(m)
+	if err != nil {
+		log.Errorf("Failed to list modules: %v", err)
+		return
+	}
+	ticker := time.NewTicker(m.Options.ModuleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		loaded, err := t.scan(m)
+		if err != nil {
+			log.Errorf("Failed to list modules: %v", err)
+			continue
+		}
+		for _, data := range loaded {
+			m.emitModuleLoad(data)
+		}
+	}
+}
+
+// emitModuleLoad emits a module loaded event, which is sent once the module has been hashed by the hash pool if it hasn't been hashed before.
+func (m *AuditMonitor) emitModuleLoad(data ProcessModuleLoadEventData) {
+	emit := func(ctx context.Context) {
+		log.Infof("Process loaded module (PID: %d, name: %s, path: %s)", data.PID, data.Name, data.Module.Path)
+		m.emitContext(ctx, NewEvent(ObjectTypeProcess, EventTypeModuleLoaded, data))
+	}
+	path := data.Module.hashPath()
+	if m.hashes == nil || !m.Options.IncludeHashes || path == "" || data.Module.Hashes != nil {
+		emit(context.Background())
+		return
+	}
+	if hashes, ok := getCachedFileHashes(path, m.Options.HashOptions); ok {
+		data.Module.Hashes = hashes
+		emit(context.Background())
+		return
+	}
+	ch, err := m.hashes.Submit(path)
+	if err != nil {
+		log.Debugf("Not hashing module: %v (path: %s)", err, data.Module.Path)
+		emit(context.Background())
+		return
+	}
+	ctx := m.runContext()
+	m.enrichers.Add(1)
+	go func() {
+		defer m.enrichers.Done()
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				log.Debugf("Failed to hash module: %v (path: %s)", r.err, data.Module.Path)
+			} else {
+				data.Module.Hashes = r.hashes
+			}
+		case <-ctx.Done():
+			return
+		}
+		emit(ctx)
+	}()
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"debug/elf"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procMapping is a file-backed mapping read from /proc/<pid>/maps.
+type procMapping struct {
+	// Addresses is the address range of the mapping (e.g. 7f87cc85e000-7f87cc9b3000), which is also its name in /proc/<pid>/map_files.
+	Addresses string
+	Start     uint64
+	Perms     string
+	Path      string
+	Deleted   bool
+}
+
+// getProcessModules returns the modules mapped by a process in order of their base address (i.e. the lowest address each of them is mapped at). Any file with an executable mapping (e.g. r-xp, or rwxp for injected code) which starts with an ELF header is treated as a module regardless of its name (e.g. /tmp/x or a memfd: file), other than the executable of the process itself.
+//
+// Files whose paths are in seen are skipped without being read, and the path of each file which is checked is added to it (seen may be nil).
+func getProcessModules(pid int32, seen map[string]struct{}) ([]Module, error) {
+	b, err := os.ReadFile(procPath(pid, "maps"))
+	if err != nil {
+		return nil, err
+	}
+	exe, _ := os.Readlink(procPath(pid, "exe"))
+	exe = strings.TrimSuffix(exe, " (deleted)")
+
+	mappings := parseProcMaps(b)
+	base := make(map[string]uint64)
+	for _, mapping := range mappings {
+		if start, ok := base[mapping.Path]; !ok || mapping.Start < start {
+			base[mapping.Path] = mapping.Start
+		}
+	}
+	if seen == nil {
+		seen = make(map[string]struct{})
+	}
+	var modules []Module
+	for _, mapping := range mappings {
+		if !strings.Contains(mapping.Perms, "x") || mapping.Path == exe {
+			continue
+		}
+		if _, ok := seen[mapping.Path]; ok {
+			continue
+		}
+		seen[mapping.Path] = struct{}{}
+		if !isELFMapping(pid, mapping) {
+			continue
+		}
+		module := Module{
+			File:        NewFile(mapping.Path),
+			BaseAddress: base[mapping.Path],
+			Deleted:     mapping.Deleted,
+		}
+		if mapping.Deleted {
+			module.mapFile = procPath(pid, "map_files", mapping.Addresses)
+		}
+		modules = append(modules, module)
+	}
+	sort.SliceStable(modules, func(i, j int) bool {
+		return modules[i].BaseAddress < modules[j].BaseAddress
+	})
+	return modules, nil
+}
+
+// parseProcMaps parses /proc/<pid>/maps (see proc(5)), returning the mappings which are backed by files.
+func parseProcMaps(b []byte) []procMapping {
+	var mappings []procMapping
+	for _, line := range strings.Split(string(b), "\n") {
+		// e.g. 7f87cc838000-7f87cc85e000 r--p 00000000 fe:00 700582 /usr/lib/x86_64-linux-gnu/libc.so.6
+		fields := strings.SplitN(line, " ", 6)
+		if len(fields) < 6 || fields[4] == "0" {
+			continue
+		}
+		path := strings.TrimLeft(fields[5], " ")
+		deleted := strings.HasSuffix(path, " (deleted)")
+		path = strings.TrimSuffix(path, " (deleted)")
+		if !strings.HasPrefix(path, "/") {
+			continue
+		}
+		start, _, _ := strings.Cut(fields[0], "-")
+		base, err := strconv.ParseUint(start, 16, 64)
+		if err != nil {
+			continue
+		}
+		mappings = append(mappings, procMapping{
+			Addresses: fields[0],
+			Start:     base,
+			Perms:     fields[1],
+			Path:      path,
+			Deleted:   deleted,
+		})
+	}
+	return mappings
+}
+
+// isELFMapping checks whether a mapped file starts with an ELF header. The file is read through /proc/<pid>/map_files if possible (requires CAP_SYS_ADMIN), since that also works for files which have been deleted (e.g. memfd: files).
+func isELFMapping(pid int32, mapping procMapping) bool {
+	paths := []string{procPath(pid, "map_files", mapping.Addresses)}
+	if !mapping.Deleted {
+		paths = append(paths, mapping.Path)
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		magic := make([]byte, len(elf.ELFMAG))
+		_, err = io.ReadFull(f, magic)
+		f.Close()
+		return err == nil && string(magic) == elf.ELFMAG
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProcessModules(t *testing.T) {
+	withProcRoot(t, "testdata/proc")
+
+	modules, err := getProcessModules(100, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Module{
+		{File: NewFile("/usr/lib/x86_64-linux-gnu/libc.so.6"), BaseAddress: 0x7f87cc838000},
+		{File: NewFile("/usr/lib/x86_64-linux-gnu/libpam.so.0.85.1"), BaseAddress: 0x7f87cca10000},
+		{File: NewFile("/tmp/.x/libhook.so"), BaseAddress: 0x7f87cca20000, Deleted: true, mapFile: "testdata/proc/100/map_files/7f87cca20000-7f87cca22000"},
+		{File: NewFile("/tmp/x"), BaseAddress: 0x7f87cca34000},
+		{File: NewFile("/usr/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2"), BaseAddress: 0x7f87cca40000},
+		{File: NewFile("/tmp/.x/inject.so"), BaseAddress: 0x7f87cca68000},
+		{File: NewFile("/memfd:payload"), BaseAddress: 0x7f87cca70000, Deleted: true, mapFile: "testdata/proc/100/map_files/7f87cca70000-7f87cca72000"},
+	}, modules)
+
+	// Deleted files are hashed through /proc/<pid>/map_files.
+	hashModules(modules, nil)
+	for _, module := range modules {
+		if module.Deleted {
+			assert.NotNil(t, module.Hashes, module.Path)
+		}
+	}
+
+	// Files which have already been checked aren't read again, including files which aren't modules.
+	seen := map[string]struct{}{"/tmp/x": {}}
+	modules, err = getProcessModules(100, seen)
+	assert.Nil(t, err)
+	assert.Len(t, modules, 6)
+	assert.Contains(t, seen, "/usr/share/misc/magic.mgc")
+	assert.NotContains(t, seen, "/usr/lib/locale/C.utf8/LC_CTYPE")
+	modules, err = getProcessModules(100, seen)
+	assert.Nil(t, err)
+	assert.Empty(t, modules)
+}
+
+func TestModuleTracker(t *testing.T) {
+	self, err := os.ReadFile("/proc/self/stat")
+	assert.Nil(t, err)
+	root := t.TempDir()
+	dir := filepath.Join(root, fmt.Sprint(os.Getpid()))
+	assert.Nil(t, os.Mkdir(dir, 0o700))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "stat"), self, 0o600))
+	maps, err := os.ReadFile("testdata/proc/100/maps")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "maps"), maps, 0o600))
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "map_files"), 0o700))
+	elfHeader := []byte(elf.ELFMAG)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "map_files", "7f87cc85e000-7f87cc9b3000"), elfHeader, 0o600))
+	// The boot time is cached, so it has to be read from the real /proc.
+	_, err = getBootTime()
+	assert.Nil(t, err)
+	withProcRoot(t, root)
+
+	// The modules of a process which hasn't been seen before aren't reported.
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	tracker := newModuleTracker()
+	loaded, err := tracker.scan(m)
+	assert.Nil(t, err)
+	assert.Empty(t, loaded)
+
+	maps = append(maps, "7f87ccb00000-7f87ccb02000 r--p 00000000 fe:00 701234 /usr/lib/x86_64-linux-gnu/libz.so.1\n"...)
+	maps = append(maps, "7f87ccb02000-7f87ccb10000 r-xp 00002000 fe:00 701234 /usr/lib/x86_64-linux-gnu/libz.so.1\n"...)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "maps"), maps, 0o600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "map_files", "7f87ccb02000-7f87ccb10000"), elfHeader, 0o600))
+	loaded, err = tracker.scan(m)
+	assert.Nil(t, err)
+	assert.Len(t, loaded, 1)
+	assert.Equal(t, int32(os.Getpid()), loaded[0].PID)
+	assert.Equal(t, "/usr/lib/x86_64-linux-gnu/libz.so.1", loaded[0].Module.Path)
+	assert.Equal(t, uint64(0x7f87ccb00000), loaded[0].Module.BaseAddress)
+
+	loaded, err = tracker.scan(m)
+	assert.Nil(t, err)
+	assert.Empty(t, loaded)
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	NetworkProtocolTCP  = "tcp"
+	NetworkProtocolTCP6 = "tcp6"
+	NetworkProtocolUDP  = "udp"
+	NetworkProtocolUDP6 = "udp6"
+)
+
+type NetworkConnection struct {
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address"`
+	LocalPort     uint16 `json:"local_port"`
+	RemoteAddress string `json:"remote_address"`
+	RemotePort    uint16 `json:"remote_port"`
+
+	// State is the state of a TCP socket (e.g. LISTEN or ESTABLISHED), or for a UDP socket, either ESTABLISHED (if it's connected to a remote address) or UNCONN.
+	State string `json:"state"`
+	Inode uint64 `json:"inode"`
+
+	// PID is the ID of the process which owns the socket (0 if the owner couldn't be found), and Process describes it.
+	PID     int32            `json:"pid,omitempty"`
+	Process *ProcessAncestor `json:"process,omitempty"`
+}
+
+// key identifies a socket, which is reported as closed once it's no longer listed.
+func (c NetworkConnection) key() string {
+	return fmt.Sprintf("%s|%s|%d|%s|%d|%d", c.Protocol, c.LocalAddress, c.LocalPort, c.RemoteAddress, c.RemotePort, c.Inode)
+}
+
+// pollNetworkConnections reports TCP and UDP sockets which are opened and closed every NetworkInterval until the context is cancelled. The sockets which are already open when the monitor starts are only reported (as running) if AuditMonitorOptions.Snapshot is set.
+func (m *AuditMonitor) pollNetworkConnections(ctx context.Context) {
+	connections, err := ListNetworkConnections()
+	if err != nil {
+		log.Errorf("Failed to list network connections: %v", err)
+		return
+	}
+	p := newNetworkPoller(connections)
+	if m.Options.Snapshot {
+		for _, c := range connections {
+			m.emitNetworkConnection(EventTypeRunning, c)
+		}
+	}
+
+	ticker := time.NewTicker(m.Options.NetworkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		connections, err := ListNetworkConnections()
+		if err != nil {
+			log.Errorf("Failed to list network connections: %v", err)
+			continue
+		}
+		p.poll(m, connections)
+	}
+}
+
+// networkPoller reports the sockets which have been opened or closed between successive listings of the open sockets.
+type networkPoller struct {
+	open map[string]NetworkConnection
+}
+
+func newNetworkPoller(connections []NetworkConnection) *networkPoller {
+	p := &networkPoller{
+		open: make(map[string]NetworkConnection, len(connections)),
+	}
+	for _, c := range connections {
+		p.open[c.key()] = c
+	}
+	return p
+}
+
+func (p *networkPoller) poll(m *AuditMonitor, connections []NetworkConnection) {
+	current := make(map[string]NetworkConnection, len(connections))
+	for _, c := range connections {
+		k := c.key()
+		current[k] = c
+		if _, ok := p.open[k]; !ok {
+			m.emitNetworkConnection(EventTypeOpened, c)
+		}
+	}
+	for k, c := range p.open {
+		if _, ok := current[k]; !ok {
+			m.emitNetworkConnection(EventTypeClosed, c)
+		}
+	}
+	p.open = current
+}
+
+func (m *AuditMonitor) emitNetworkConnection(eventType EventType, c NetworkConnection) {
+	if c.PID > 0 {
+		process, _ := m.processes.Get(c.PID)
+		c.Process = &process
+	}
+	m.emit(NewEvent(ObjectTypeNetworkConnection, eventType, c))
+}
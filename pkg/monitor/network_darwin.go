@@ -0,0 +1,9 @@
+package monitor
+
+import (
+	"github.com/pkg/errors"
+)
+
+func ListNetworkConnections() ([]NetworkConnection, error) {
+	return nil, errors.New("not implemented")
+}
@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tcpStates are the names of the states in /proc/net/tcp (see include/net/tcp_states.h).
+var tcpStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW_SYN_RECV",
+}
+
+// ListNetworkConnections lists the TCP and UDP sockets in the network namespace of the current process, along with the process which owns each of them.
+func ListNetworkConnections() ([]NetworkConnection, error) {
+	var connections []NetworkConnection
+	for _, protocol := range []string{NetworkProtocolTCP, NetworkProtocolTCP6, NetworkProtocolUDP, NetworkProtocolUDP6} {
+		b, err := os.ReadFile(filepath.Join(procRoot, "net", protocol))
+		if os.IsNotExist(err) {
+			// e.g. IPv6 is disabled.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		c, err := parseProcNet(b, protocol)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, c...)
+	}
+	owners, err := getSocketOwners()
+	if err != nil {
+		return nil, err
+	}
+	for i := range connections {
+		connections[i].PID = owners[connections[i].Inode]
+	}
+	return connections, nil
+}
+
+// parseProcNet parses /proc/net/{tcp,tcp6,udp,udp6} (see proc(5)). Sockets without an inode (e.g. TCP connections in TIME_WAIT) are skipped, since they no longer belong to a process.
+func parseProcNet(b []byte, protocol string) ([]NetworkConnection, error) {
+	var connections []NetworkConnection
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Scan() // Skip the header.
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed inode: %s", fields[9])
+		}
+		if inode == 0 {
+			continue
+		}
+		c := NetworkConnection{
+			Protocol: protocol,
+			Inode:    inode,
+		}
+		c.LocalAddress, c.LocalPort, err = parseProcNetAddress(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		c.RemoteAddress, c.RemotePort, err = parseProcNetAddress(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed state: %s", fields[3])
+		}
+		switch protocol {
+		case NetworkProtocolTCP, NetworkProtocolTCP6:
+			c.State = tcpStates[state]
+		default:
+			c.State = "UNCONN"
+			if state == 0x01 {
+				c.State = "ESTABLISHED"
+			}
+		}
+		connections = append(connections, c)
+	}
+	return connections, scanner.Err()
+}
+
+// parseProcNetAddress parses an address of the form <ip>:<port>, where the IP address is written as one (IPv4) or four (IPv6) 32-bit words in host byte order and the port in network byte order.
+func parseProcNetAddress(s string) (string, uint16, error) {
+	host, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, errors.Errorf("malformed address: %s", s)
+	}
+	b, err := hex.DecodeString(host)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return "", 0, errors.Errorf("malformed address: %s", s)
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(b[i:]))
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return "", 0, errors.Errorf("malformed address: %s", s)
+	}
+	return ip.String(), uint16(p), nil
+}
+
+// getSocketOwners maps the inode of each socket to the process which has it open, by reading the links in /proc/<pid>/fd (e.g. socket:[12345]). A socket shared by several processes (e.g. after a fork) is attributed to the one with the lowest PID.
+func getSocketOwners() (map[uint64]int32, error) {
+	pids, err := listPids()
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[uint64]int32)
+	for _, pid := range pids {
+		dir := procPath(pid, "fd")
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			// e.g. the process has exited, or we aren't allowed to read its file descriptors.
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if owner, ok := owners[inode]; !ok || pid < owner {
+				owners[inode] = pid
+			}
+		}
+	}
+	return owners, nil
+}
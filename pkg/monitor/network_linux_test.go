@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListNetworkConnections(t *testing.T) {
+	withProcRoot(t, "testdata/proc")
+
+	connections, err := ListNetworkConnections()
+	assert.Nil(t, err)
+	assert.Equal(t, []NetworkConnection{
+		{Protocol: NetworkProtocolTCP, LocalAddress: "127.0.0.1", LocalPort: 631, RemoteAddress: "0.0.0.0", State: "LISTEN", Inode: 1001, PID: 100},
+		{Protocol: NetworkProtocolTCP, LocalAddress: "10.0.2.15", LocalPort: 54321, RemoteAddress: "192.168.4.34", RemotePort: 443, State: "ESTABLISHED", Inode: 1002, PID: 100},
+		{Protocol: NetworkProtocolTCP6, LocalAddress: "::1", LocalPort: 8080, RemoteAddress: "::", State: "LISTEN", Inode: 1003},
+		{Protocol: NetworkProtocolUDP, LocalAddress: "0.0.0.0", LocalPort: 68, RemoteAddress: "0.0.0.0", State: "UNCONN", Inode: 1004, PID: 100},
+	}, connections)
+}
+
+func TestParseProcNetAddress(t *testing.T) {
+	for s, expected := range map[string]struct {
+		ip   string
+		port uint16
+	}{
+		"0100007F:0035":                         {"127.0.0.1", 53},
+		"00000000000000000000000001000000:0016": {"::1", 22},
+		"0000000000000000FFFF00000100007F:01BB": {"127.0.0.1", 443},
+	} {
+		ip, port, err := parseProcNetAddress(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected.ip, ip, s)
+		assert.Equal(t, expected.port, port, s)
+	}
+	for _, s := range []string{"", "0100007F", "01007F:0035", "0100007F:XYZ"} {
+		_, _, err := parseProcNetAddress(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestNetworkPoller(t *testing.T) {
+	withProcRoot(t, "testdata/proc")
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.processes = newProcessCache(10)
+	m.cacheProcess(&Process{PID: 100, Name: "cupsd"})
+
+	connections, err := ListNetworkConnections()
+	assert.Nil(t, err)
+	assert.Len(t, connections, 4)
+
+	// The first socket was opened since the previous poll, another one has since been closed, and the third has been replaced by a new socket with the same addresses.
+	closed := NetworkConnection{Protocol: NetworkProtocolTCP, LocalAddress: "127.0.0.1", LocalPort: 5432, RemoteAddress: "0.0.0.0", State: "LISTEN", Inode: 999}
+	replaced := connections[2]
+	replaced.Inode = 998
+	p := newNetworkPoller([]NetworkConnection{closed, connections[1], replaced, connections[3]})
+	p.poll(m, connections)
+
+	opened := make(map[uint64]NetworkConnection)
+	closedByInode := make(map[uint64]NetworkConnection)
+	for _, e := range readEvents(m) {
+		c := e.Data.(NetworkConnection)
+		switch e.Header.EventType {
+		case EventTypeOpened:
+			opened[c.Inode] = c
+		case EventTypeClosed:
+			closedByInode[c.Inode] = c
+		default:
+			t.Fatalf("unexpected event type: %s", e.Header.EventType)
+		}
+	}
+	assert.Len(t, opened, 2)
+	assert.Equal(t, "cupsd", opened[connections[0].Inode].Process.Name)
+	assert.Contains(t, opened, connections[2].Inode)
+	assert.Len(t, closedByInode, 2)
+	assert.Equal(t, closed.LocalPort, closedByInode[closed.Inode].LocalPort)
+	assert.Contains(t, closedByInode, replaced.Inode)
+
+	// Nothing is reported if nothing has changed.
+	p.poll(m, connections)
+	assert.Empty(t, readEvents(m))
+}
+
+func TestNetworkIntervalAncestors(t *testing.T) {
+	// The process cache is needed to describe the owners of sockets, but ancestors are only included if requested.
+	opts := GetDefaultAuditMonitorOptions()
+	opts.NetworkInterval = time.Second
+	m, err := NewAuditMonitor(nil, opts)
+	assert.Nil(t, err)
+	assert.NotNil(t, m.processes)
+	tree := NewProcessTree()
+	tree.AddProcess(1, 100)
+	m.cacheProcess(&Process{PID: 1, Name: "init"})
+	p := &Process{PID: 100}
+	m.setAncestors(p, tree)
+	assert.Nil(t, p.Ancestors)
+}
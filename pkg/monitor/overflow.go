@@ -0,0 +1,279 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OverflowBlock blocks until the consumer reads from AuditMonitor.Events (i.e. detection stalls).
+	OverflowBlock = "block"
+
+	// OverflowDropNewest drops the event being sent if AuditMonitor.Events is full.
+	OverflowDropNewest = "drop-newest"
+
+	// OverflowDropOldest drops the oldest buffered event to make room for the event being sent if AuditMonitor.Events is full.
+	OverflowDropOldest = "drop-oldest"
+
+	// OverflowSpill writes events to a queue on disk while AuditMonitor.Events is full, and replays them in order once the consumer catches up.
+	OverflowSpill = "spill"
+)
+
+var (
+	spillRetryInterval = 100 * time.Millisecond
+)
+
+// eventCounters are updated atomically as events are emitted.
+type eventCounters struct {
+	emitted       atomic.Uint64
+	droppedNewest atomic.Uint64
+	droppedOldest atomic.Uint64
+	spilled       atomic.Uint64
+
+	// kernelOverflows counts the times the kernel dropped events before we could read them.
+	kernelOverflows atomic.Uint64
+}
+
+// emit sends an event to AuditMonitor.Events according to the overflow policy.
+func (m *AuditMonitor) emit(e Event) {
+	m.emitContext(context.Background(), e)
+}
+
+// emitContext sends an event like emit, but drops it rather than blocking once the context is cancelled (e.g. if the monitor has stopped and nothing is reading its events).
+func (m *AuditMonitor) emitContext(ctx context.Context, e Event) {
+	m.counters.emitted.Add(1)
+	if m.host != nil {
+		e.Header.Host = m.host
+	}
+	if m.state != nil {
+		m.state.observe(e)
+	}
+
+	switch m.Options.OverflowPolicy {
+	case OverflowDropNewest:
+		select {
+		case m.Events <- e:
+		default:
+			m.counters.droppedNewest.Add(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case m.Events <- e:
+				return
+			default:
+			}
+			select {
+			case <-m.Events:
+				m.counters.droppedOldest.Add(1)
+			default:
+			}
+		}
+	case OverflowSpill:
+		// Once we've started spilling, events must keep going to disk until the queue has been drained to preserve their order.
+		if m.spill.Len() == 0 {
+			select {
+			case m.Events <- e:
+				return
+			default:
+			}
+		}
+		err := m.spill.Push(e)
+		if err != nil {
+			log.Errorf("Failed to spill event to disk: %v", err)
+			m.counters.droppedNewest.Add(1)
+			return
+		}
+		m.counters.spilled.Add(1)
+	default:
+		select {
+		case m.Events <- e:
+		case <-ctx.Done():
+			m.counters.droppedNewest.Add(1)
+		}
+	}
+}
+
+// drainSpillQueue replays spilled events into AuditMonitor.Events until the context is cancelled.
+func (m *AuditMonitor) drainSpillQueue(ctx context.Context) {
+	for ctx.Err() == nil {
+		e, err := m.spill.Peek()
+		if err != nil {
+			log.Errorf("Failed to read spilled event: %v", err)
+			m.spill.Pop()
+			continue
+		}
+		if e == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.spill.notify:
+			case <-time.After(spillRetryInterval):
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case m.Events <- *e:
+			m.spill.Pop()
+		}
+	}
+}
+
+// SpillQueueLength returns the number of events which are waiting in the spill queue to be sent to Events.
+func (m *AuditMonitor) SpillQueueLength() int {
+	return m.spill.Len()
+}
+
+// spillQueue is a FIFO queue of newline-delimited JSON events stored in a file.
+type spillQueue struct {
+	mu     sync.Mutex
+	path   string
+	dir    string
+	w      *os.File
+	r      *bufio.Reader
+	rf     *os.File
+	next   *Event
+	length int
+	notify chan struct{}
+}
+
+func newSpillQueue(path string) (*spillQueue, error) {
+	// The default path is in a private directory, since a predictable path in a shared directory could be replaced by another user (e.g. with a symlink to a file for us to truncate).
+	var dir string
+	if path == "" {
+		var err error
+		dir, err = os.MkdirTemp("", "go-audit-spill-")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create spill directory")
+		}
+		path = filepath.Join(dir, "spill.jsonl")
+	}
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		removeSpillDir(dir)
+		return nil, errors.Wrap(err, "failed to create spill file")
+	}
+	rf, err := os.Open(path)
+	if err != nil {
+		w.Close()
+		os.Remove(path)
+		removeSpillDir(dir)
+		return nil, errors.Wrap(err, "failed to open spill file")
+	}
+	return &spillQueue{
+		path:   path,
+		dir:    dir,
+		w:      w,
+		rf:     rf,
+		r:      bufio.NewReader(rf),
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+func (q *spillQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length
+}
+
+func (q *spillQueue) Push(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err = q.w.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	q.length++
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek returns the oldest event in the queue without removing it, or nil if the queue is empty.
+func (q *spillQueue) Peek() (*Event, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.next != nil {
+		return q.next, nil
+	}
+	if q.length == 0 {
+		return nil, nil
+	}
+	line, err := q.r.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("spill file is shorter than expected")
+		}
+		return nil, err
+	}
+	e := &Event{}
+	err = json.Unmarshal(line, e)
+	if err != nil {
+		return nil, err
+	}
+	q.next = e
+	return q.next, nil
+}
+
+// Pop removes the oldest event from the queue, truncating the file once the queue is empty.
+func (q *spillQueue) Pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.length == 0 {
+		return
+	}
+	q.next = nil
+	q.length--
+	if q.length > 0 {
+		return
+	}
+	err := q.w.Truncate(0)
+	if err == nil {
+		_, err = q.w.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		_, err = q.rf.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Warnf("Failed to truncate spill file: %v", err)
+		return
+	}
+	q.r.Reset(q.rf)
+}
+
+func (q *spillQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rf.Close()
+	err := q.w.Close()
+	os.Remove(q.path)
+	removeSpillDir(q.dir)
+	return err
+}
+
+func removeSpillDir(dir string) {
+	if dir != "" {
+		os.Remove(dir)
+	}
+}
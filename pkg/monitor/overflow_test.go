@@ -0,0 +1,138 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAuditMonitor(t *testing.T, policy string, size int) *AuditMonitor {
+	opts := GetDefaultAuditMonitorOptions()
+	opts.OverflowPolicy = policy
+	opts.SpillPath = filepath.Join(t.TempDir(), "spill.jsonl")
+	m, err := NewAuditMonitor(nil, opts)
+	assert.Nil(t, err)
+	m.Events = make(chan Event, size)
+	return m
+}
+
+// readEvents returns the events which have been emitted without waiting for more.
+func readEvents(m *AuditMonitor) []Event {
+	var events []Event
+	for {
+		select {
+		case e := <-m.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func newTestEvent(pid int32) Event {
+	return NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: pid}})
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowDropNewest, 2)
+	for i := int32(1); i <= 5; i++ {
+		m.emit(newTestEvent(i))
+	}
+	telemetry := m.GetTelemetry()
+	assert.Equal(t, uint64(5), telemetry.Events)
+	assert.Equal(t, uint64(3), telemetry.DroppedNewest)
+	assert.Equal(t, int32(1), (<-m.Events).Data.(ProcessStartEventData).PID)
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowDropOldest, 2)
+	for i := int32(1); i <= 5; i++ {
+		m.emit(newTestEvent(i))
+	}
+	assert.Equal(t, uint64(3), m.GetTelemetry().DroppedOldest)
+	assert.Equal(t, int32(4), (<-m.Events).Data.(ProcessStartEventData).PID)
+	assert.Equal(t, int32(5), (<-m.Events).Data.(ProcessStartEventData).PID)
+}
+
+func TestOverflowSpill(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowSpill, 2)
+	defer m.spill.Close()
+	for i := int32(1); i <= 5; i++ {
+		m.emit(newTestEvent(i))
+	}
+	assert.Equal(t, uint64(3), m.GetTelemetry().Spilled)
+	assert.Equal(t, 3, m.spill.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go m.drainSpillQueue(ctx)
+
+	// Spilled events are replayed in order, with their data decoded into its original type.
+	for i := int32(1); i <= 5; i++ {
+		e := <-m.Events
+		assert.Equal(t, i, e.Data.(ProcessStartEventData).PID)
+	}
+}
+
+func TestOverflowSpillProcessTree(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowSpill, 1)
+	defer m.spill.Close()
+	m.emit(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 10, PPID: 1}}))
+	m.emit(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 11, PPID: 10}}))
+	m.emit(NewEvent(ObjectTypeProcess, EventTypeStopped, ProcessStopEventData{PID: 11}))
+	assert.Equal(t, 2, m.spill.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go m.drainSpillQueue(ctx)
+
+	// Consumers which switch on the type of the data see spilled events too.
+	tree := NewProcessTree()
+	for i := 0; i < 3; i++ {
+		tree.ApplyEvent(<-m.Events)
+	}
+	assert.Equal(t, []int32{1}, tree.GetAncestorPids(10))
+	assert.Equal(t, []int32{10}, tree.GetDescendantPids(1))
+}
+
+func TestSpillQueueDefaultPath(t *testing.T) {
+	q, err := newSpillQueue("")
+	assert.Nil(t, err)
+	info, err := os.Stat(q.dir)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	assert.Nil(t, q.Close())
+	assert.NoDirExists(t, q.dir)
+}
+
+func TestEventUnmarshalJSON(t *testing.T) {
+	for _, e := range []Event{
+		NewEvent(ObjectTypeProcess, EventTypeStopped, ProcessStopEventData{PID: 1}),
+		NewEvent(ObjectTypeFile, EventTypeCreated, FileEventData{OldPath: "/tmp/a"}),
+		NewEvent(ObjectTypeNetworkConnection, EventTypeOpened, NetworkConnection{Protocol: NetworkProtocolTCP, LocalPort: 22}),
+	} {
+		b, err := json.Marshal(e)
+		assert.Nil(t, err)
+		var decoded Event
+		assert.Nil(t, json.Unmarshal(b, &decoded))
+		assert.Equal(t, e.Data, decoded.Data)
+		assert.Equal(t, e.Header.Id, decoded.Header.Id)
+	}
+
+	// The data of an unknown type of event is kept as raw JSON.
+	var e Event
+	assert.Nil(t, json.Unmarshal([]byte(`{"header":{"object_type":"other"},"data":{"a":1}}`), &e))
+	assert.Equal(t, json.RawMessage(`{"a":1}`), e.Data)
+}
+
+func TestInvalidOverflowPolicy(t *testing.T) {
+	opts := GetDefaultAuditMonitorOptions()
+	opts.OverflowPolicy = "explode"
+	_, err := NewAuditMonitor(nil, opts)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,383 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+// Constants from linux/connector.h and linux/cn_proc.h.
+const (
+	_CN_IDX_PROC = 1
+	_CN_VAL_PROC = 1
+
+	_PROC_CN_MCAST_LISTEN = 1
+	_PROC_CN_MCAST_IGNORE = 2
+
+	_PROC_EVENT_NONE = 0x00000000
+	_PROC_EVENT_FORK = 0x00000001
+	_PROC_EVENT_EXEC = 0x00000002
+	_PROC_EVENT_UID  = 0x00000004
+	_PROC_EVENT_GID  = 0x00000040
+	_PROC_EVENT_COMM = 0x00000200
+	_PROC_EVENT_EXIT = 0x80000000
+)
+
+const (
+	cnMsgSize                   = 20 // struct cn_msg without payload
+	procEventHeaderLen          = 16 // what, cpu, timestamp_ns
+	procConnectorRecvBufferSize = 64 * 1024
+	procConnectorReadTimeout    = 250 * time.Millisecond
+)
+
+type procEvent struct {
+	What      uint32
+	CPU       uint32
+	Timestamp uint64
+
+	// FORK
+	ParentPID  int32
+	ParentTGID int32
+	ChildPID   int32
+	ChildTGID  int32
+
+	// EXEC, UID, GID, COMM, EXIT
+	PID  int32
+	TGID int32
+
+	// UID, GID
+	RealId      uint32
+	EffectiveId uint32
+
+	// COMM
+	Comm string
+
+	// EXIT
+	ExitCode   uint32
+	ExitSignal uint32
+}
+
+type procConnector struct {
+	fd        int
+	buf       []byte
+	processes map[int32]*ProcessIdentity
+	tree      *ProcessTree
+	matched   map[int32]bool
+}
+
+func newProcConnector() (*procConnector, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create netlink socket")
+	}
+	c := &procConnector{
+		fd:        fd,
+		buf:       make([]byte, procStatBufferSize),
+		processes: make(map[int32]*ProcessIdentity),
+		tree:      NewProcessTree(),
+		matched:   make(map[int32]bool),
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: _CN_IDX_PROC,
+	})
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "failed to bind netlink socket")
+	}
+	tv := syscall.NsecToTimeval(procConnectorReadTimeout.Nanoseconds())
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "failed to set netlink socket timeout")
+	}
+	err = c.setMulticast(_PROC_CN_MCAST_LISTEN)
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "failed to subscribe to process events")
+	}
+	return c, nil
+}
+
+func (c *procConnector) Close() error {
+	_ = c.setMulticast(_PROC_CN_MCAST_IGNORE)
+	return syscall.Close(c.fd)
+}
+
+func (c *procConnector) setMulticast(op uint32) error {
+	b := make([]byte, syscall.NLMSG_HDRLEN+cnMsgSize+4)
+	ne := binary.NativeEndian
+
+	// struct nlmsghdr
+	ne.PutUint32(b[0:4], uint32(len(b)))
+	ne.PutUint16(b[4:6], syscall.NLMSG_DONE)
+	ne.PutUint32(b[12:16], uint32(os.Getpid()))
+
+	// struct cn_msg
+	msg := b[syscall.NLMSG_HDRLEN:]
+	ne.PutUint32(msg[0:4], _CN_IDX_PROC)
+	ne.PutUint32(msg[4:8], _CN_VAL_PROC)
+	ne.PutUint16(msg[16:18], 4)
+	ne.PutUint32(msg[cnMsgSize:], op)
+
+	return syscall.Sendto(c.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// Run reads process events from the kernel until the context is cancelled.
+func (c *procConnector) Run(ctx context.Context, m *AuditMonitor) error {
+	c.seed(m)
+	m.setReady()
+
+	buf := make([]byte, procConnectorRecvBufferSize)
+	for ctx.Err() == nil {
+		n, from, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			if err == syscall.ENOBUFS {
+				log.Warnf("Netlink receive buffer overrun, some process events were lost")
+				m.counters.kernelOverflows.Add(1)
+				continue
+			}
+			return errors.Wrap(err, "failed to read from netlink socket")
+		}
+		if sa, ok := from.(*syscall.SockaddrNetlink); !ok || sa.Pid != 0 {
+			// Only trust messages sent by the kernel.
+			continue
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			log.Warnf("Failed to parse netlink message: %v", err)
+			continue
+		}
+		for _, msg := range msgs {
+			if msg.Header.Type != syscall.NLMSG_DONE || len(msg.Data) < cnMsgSize {
+				continue
+			}
+			e, err := parseProcEvent(msg.Data[cnMsgSize:])
+			if err != nil {
+				log.Warnf("Failed to parse process event: %v", err)
+				continue
+			}
+			evt := c.handle(m, e)
+			if evt != nil {
+				m.emitProcessEvent(*evt)
+			}
+		}
+	}
+	return nil
+}
+
+// seed records the processes which are already running so that we can report their parent and create time when they exit.
+func (c *procConnector) seed(m *AuditMonitor) {
+	ids, err := listProcessIdentities()
+	if err != nil {
+		log.Warnf("Failed to list processes: %v", err)
+		return
+	}
+	c.tree = NewProcessTreeFromProcessIdentities(ids)
+	for i, id := range ids {
+		c.processes[id.PID] = &ids[i]
+		c.matched[id.PID] = m.matchesRunningProcess(id, c.tree)
+	}
+}
+
+func (c *procConnector) track(pid, ppid int32) {
+	c.tree.AddProcess(ppid, pid)
+	id := &ProcessIdentity{
+		PID:  pid,
+		PPID: ppid,
+	}
+	stat, err := readProcStat(pid, c.buf)
+	if err == nil {
+		id.StartTime = stat.StartTime
+	}
+	c.processes[pid] = id
+}
+
+func (c *procConnector) getIdentity(pid int32) (*ProcessIdentity, error) {
+	id, ok := c.processes[pid]
+	if !ok {
+		return nil, errors.Errorf("process not found (PID: %d)", pid)
+	}
+	return id, nil
+}
+
+func (c *procConnector) getGUID(pid int32) string {
+	id, ok := c.processes[pid]
+	if !ok {
+		return ""
+	}
+	return id.GUID()
+}
+
+func (c *procConnector) handle(m *AuditMonitor, e *procEvent) *Event {
+	f := m.ProcessFilter
+	switch e.What {
+	case _PROC_EVENT_FORK:
+		if e.ChildPID != e.ChildTGID {
+			// A new thread rather than a new process.
+			return nil
+		}
+		c.track(e.ChildTGID, e.ParentTGID)
+		m.forgetProcess(e.ChildTGID)
+
+		// A forked process is only reported once it calls exec, so that each process which is reported as stopped has been reported as started.
+		delete(c.matched, e.ChildTGID)
+		return nil
+
+	case _PROC_EVENT_EXEC:
+		process, err := GetProcess(e.TGID, m.getNewProcessOptions())
+		if err != nil {
+			log.Warnf("A new process was detected, but we weren't fast enough to get its details: %v (PID: %d)", err, e.TGID)
+			process = &Process{PID: e.TGID}
+			if id, ok := c.processes[e.TGID]; ok {
+				process.PPID = id.PPID
+			}
+		}
+		if _, ok := c.processes[e.TGID]; !ok {
+			c.track(process.PID, process.PPID)
+		}
+		if process.GUID == "" {
+			setProcessGUIDs(process, c.getIdentity)
+		}
+		m.cacheProcess(process)
+		matched := f.MatchesPID(process.PID, c.tree) && m.matchesProcess(process)
+		c.matched[e.TGID] = matched
+		if !matched {
+			return nil
+		}
+		m.setAncestors(process, c.tree)
+		log.Infof("Process started (PID: %d, PPID: %d, name: %s)", process.PID, process.PPID, process.Name)
+		evt := NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: *process})
+		return &evt
+
+	case _PROC_EVENT_EXIT:
+		if e.PID != e.TGID {
+			return nil
+		}
+		matched := c.matched[e.TGID]
+		delete(c.matched, e.TGID)
+		c.tree.ExitProcess(e.TGID)
+		if !matched {
+			delete(c.processes, e.TGID)
+			return nil
+		}
+		data := &ProcessStopEventData{
+			PID: e.TGID,
+		}
+		if id, ok := c.processes[e.TGID]; ok {
+			data = newProcessStopEventData(*id, c.getIdentity)
+		}
+		delete(c.processes, e.TGID)
+
+		now := time.Now()
+		data.ExitTime = &now
+
+		status := syscall.WaitStatus(e.ExitCode)
+		if status.Signaled() {
+			signal := int(status.Signal())
+			data.Signal = &signal
+		} else {
+			code := status.ExitStatus()
+			data.ExitCode = &code
+		}
+		data.calculateLifetime()
+		log.Infof("Process stopped (PID: %d)", data.PID)
+		evt := NewEvent(ObjectTypeProcess, EventTypeStopped, *data)
+		return &evt
+
+	case _PROC_EVENT_UID, _PROC_EVENT_GID:
+		if e.PID != e.TGID || !c.matched[e.TGID] {
+			return nil
+		}
+		realId, effectiveId := e.RealId, e.EffectiveId
+		data := ProcessModifyEventData{
+			GUID: c.getGUID(e.TGID),
+			PID:  e.TGID,
+		}
+		if e.What == _PROC_EVENT_UID {
+			data.RUID, data.EUID = &realId, &effectiveId
+		} else {
+			data.RGID, data.EGID = &realId, &effectiveId
+		}
+		evt := NewEvent(ObjectTypeProcess, EventTypeModified, data)
+		return &evt
+
+	case _PROC_EVENT_COMM:
+		if e.PID != e.TGID || !c.matched[e.TGID] {
+			return nil
+		}
+		evt := NewEvent(ObjectTypeProcess, EventTypeModified, ProcessModifyEventData{
+			GUID: c.getGUID(e.TGID),
+			PID:  e.TGID,
+			Name: e.Comm,
+		})
+		return &evt
+	}
+	return nil
+}
+
+// parseProcEvent parses a struct proc_event (see linux/cn_proc.h).
+func parseProcEvent(b []byte) (*procEvent, error) {
+	if len(b) < procEventHeaderLen {
+		return nil, errors.New("short proc_event")
+	}
+	ne := binary.NativeEndian
+	e := &procEvent{
+		What:      ne.Uint32(b[0:4]),
+		CPU:       ne.Uint32(b[4:8]),
+		Timestamp: ne.Uint64(b[8:16]),
+	}
+	data := b[procEventHeaderLen:]
+	i32 := func(i int) int32 {
+		return int32(ne.Uint32(data[i*4 : i*4+4]))
+	}
+
+	var want int
+	switch e.What {
+	case _PROC_EVENT_FORK:
+		want = 16
+	case _PROC_EVENT_EXEC:
+		want = 8
+	case _PROC_EVENT_UID, _PROC_EVENT_GID:
+		want = 16
+	case _PROC_EVENT_COMM:
+		want = 24
+	case _PROC_EVENT_EXIT:
+		want = 16
+	}
+	if len(data) < want {
+		return nil, errors.Errorf("short proc_event (what: %#x, length: %d)", e.What, len(b))
+	}
+
+	switch e.What {
+	case _PROC_EVENT_FORK:
+		e.ParentPID, e.ParentTGID, e.ChildPID, e.ChildTGID = i32(0), i32(1), i32(2), i32(3)
+	case _PROC_EVENT_EXEC:
+		e.PID, e.TGID = i32(0), i32(1)
+	case _PROC_EVENT_UID, _PROC_EVENT_GID:
+		e.PID, e.TGID = i32(0), i32(1)
+		e.RealId, e.EffectiveId = uint32(i32(2)), uint32(i32(3))
+	case _PROC_EVENT_COMM:
+		e.PID, e.TGID = i32(0), i32(1)
+		comm := data[8:24]
+		for i, c := range comm {
+			if c == 0 {
+				comm = comm[:i]
+				break
+			}
+		}
+		e.Comm = string(comm)
+	case _PROC_EVENT_EXIT:
+		e.PID, e.TGID = i32(0), i32(1)
+		e.ExitCode, e.ExitSignal = uint32(i32(2)), uint32(i32(3))
+	}
+	return e, nil
+}
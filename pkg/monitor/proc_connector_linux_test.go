@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestProcEvent encodes a struct proc_event with the given event-specific fields.
+func newTestProcEvent(what uint32, fields ...uint32) []byte {
+	b := make([]byte, procEventHeaderLen+4*len(fields))
+	ne := binary.NativeEndian
+	ne.PutUint32(b[0:4], what)
+	ne.PutUint32(b[4:8], 3)
+	ne.PutUint64(b[8:16], 123456789)
+	for i, v := range fields {
+		ne.PutUint32(b[procEventHeaderLen+4*i:], v)
+	}
+	return b
+}
+
+func TestParseProcEvent(t *testing.T) {
+	comm := []byte("bash\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	tests := []struct {
+		b        []byte
+		expected procEvent
+	}{
+		{
+			b:        newTestProcEvent(_PROC_EVENT_FORK, 100, 100, 101, 101),
+			expected: procEvent{What: _PROC_EVENT_FORK, ParentPID: 100, ParentTGID: 100, ChildPID: 101, ChildTGID: 101},
+		},
+		{
+			b:        newTestProcEvent(_PROC_EVENT_EXEC, 101, 101),
+			expected: procEvent{What: _PROC_EVENT_EXEC, PID: 101, TGID: 101},
+		},
+		{
+			b:        newTestProcEvent(_PROC_EVENT_UID, 101, 101, 1000, 0),
+			expected: procEvent{What: _PROC_EVENT_UID, PID: 101, TGID: 101, RealId: 1000, EffectiveId: 0},
+		},
+		{
+			b:        append(newTestProcEvent(_PROC_EVENT_COMM, 101, 101), comm...),
+			expected: procEvent{What: _PROC_EVENT_COMM, PID: 101, TGID: 101, Comm: "bash"},
+		},
+		{
+			b:        newTestProcEvent(_PROC_EVENT_EXIT, 101, 101, 1<<8, 17),
+			expected: procEvent{What: _PROC_EVENT_EXIT, PID: 101, TGID: 101, ExitCode: 1 << 8, ExitSignal: 17},
+		},
+	}
+	for _, test := range tests {
+		e, err := parseProcEvent(test.b)
+		assert.Nil(t, err)
+		test.expected.CPU = 3
+		test.expected.Timestamp = 123456789
+		assert.Equal(t, test.expected, *e)
+	}
+
+	_, err := parseProcEvent(make([]byte, procEventHeaderLen-1))
+	assert.NotNil(t, err)
+	_, err = parseProcEvent(newTestProcEvent(_PROC_EVENT_FORK, 100, 100, 101))
+	assert.NotNil(t, err)
+}
+
+func newTestProcConnector() *procConnector {
+	return &procConnector{
+		buf:       make([]byte, procStatBufferSize),
+		processes: make(map[int32]*ProcessIdentity),
+		tree:      NewProcessTree(),
+		matched:   make(map[int32]bool),
+	}
+}
+
+func TestProcConnectorHandle(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	c := newTestProcConnector()
+	pid := int32(os.Getpid())
+	handle := func(b []byte) *Event {
+		e, err := parseProcEvent(b)
+		assert.Nil(t, err)
+		return c.handle(m, e)
+	}
+
+	// New threads are ignored, and new processes are tracked until they exit.
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1, 1, 1001, 1000)))
+	assert.NotContains(t, c.processes, int32(1001))
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1, 1, uint32(pid), uint32(pid))))
+	assert.Equal(t, int32(1), c.processes[pid].PPID)
+	assert.False(t, c.matched[pid])
+
+	e := handle(newTestProcEvent(_PROC_EVENT_EXEC, uint32(pid), uint32(pid)))
+	assert.NotNil(t, e)
+	assert.Equal(t, EventType(EventTypeStarted), e.Header.EventType)
+	assert.Equal(t, pid, e.Data.(ProcessStartEventData).PID)
+
+	e = handle(newTestProcEvent(_PROC_EVENT_UID, uint32(pid), uint32(pid), 1000, 0))
+	assert.NotNil(t, e)
+	modified := e.Data.(ProcessModifyEventData)
+	assert.Equal(t, uint32(1000), *modified.RUID)
+	assert.Equal(t, uint32(0), *modified.EUID)
+	assert.Nil(t, modified.RGID)
+
+	e = handle(append(newTestProcEvent(_PROC_EVENT_COMM, uint32(pid), uint32(pid)), []byte("renamed\x00\x00\x00\x00\x00\x00\x00\x00\x00")...))
+	assert.NotNil(t, e)
+	assert.Equal(t, "renamed", e.Data.(ProcessModifyEventData).Name)
+
+	e = handle(newTestProcEvent(_PROC_EVENT_EXIT, uint32(pid), uint32(pid), 1<<8, 17))
+	assert.NotNil(t, e)
+	stopped := e.Data.(ProcessStopEventData)
+	assert.Equal(t, pid, stopped.PID)
+	assert.Equal(t, int32(1), *stopped.PPID)
+	assert.Equal(t, 1, *stopped.ExitCode)
+	assert.Nil(t, stopped.Signal)
+	assert.NotContains(t, c.processes, pid)
+
+	// A process which forks and exits without calling exec isn't reported.
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1, 1, 1002, 1002)))
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_UID, 1002, 1002, 1000, 0)))
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_EXIT, 1002, 1002, 0, 17)))
+	assert.NotContains(t, c.processes, int32(1002))
+
+	// A process which has already exited by the time it's read still has a GUID.
+	c.processes[1] = &ProcessIdentity{PID: 1, StartTime: 1}
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1, 1, 1003, 1003)))
+	c.processes[1003].StartTime = 100
+	e = handle(newTestProcEvent(_PROC_EVENT_EXEC, 1003, 1003))
+	assert.NotNil(t, e)
+	started := e.Data.(ProcessStartEventData)
+	assert.Equal(t, int32(1), started.PPID)
+	assert.Equal(t, c.processes[1003].GUID(), started.GUID)
+	assert.NotEmpty(t, started.GUID)
+	assert.Equal(t, c.processes[1].GUID(), started.ParentGUID)
+
+	// A process which was killed by a signal has no exit code.
+	e = handle(newTestProcEvent(_PROC_EVENT_EXIT, 1003, 1003, 9, 17))
+	assert.NotNil(t, e)
+	stopped = e.Data.(ProcessStopEventData)
+	assert.Equal(t, 9, *stopped.Signal)
+	assert.Nil(t, stopped.ExitCode)
+}
+
+func TestProcConnectorHandleFilter(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.ProcessFilter = &ProcessFilter{AncestorPIDs: []int32{1000}}
+	c := newTestProcConnector()
+	pid := int32(os.Getpid())
+	handle := func(b []byte) *Event {
+		e, err := parseProcEvent(b)
+		assert.Nil(t, err)
+		return c.handle(m, e)
+	}
+
+	// Processes which aren't descendants of the given ancestors aren't reported.
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1, 1, uint32(pid), uint32(pid))))
+	assert.False(t, c.matched[pid])
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_EXEC, uint32(pid), uint32(pid))))
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_UID, uint32(pid), uint32(pid), 1000, 0)))
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_EXIT, uint32(pid), uint32(pid), 0, 17)))
+
+	// A descendant is reported once it calls exec.
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1, 1, 1000, 1000)))
+	assert.Nil(t, handle(newTestProcEvent(_PROC_EVENT_FORK, 1000, 1000, 1001, 1001)))
+	assert.False(t, c.matched[1001])
+	assert.NotNil(t, handle(newTestProcEvent(_PROC_EVENT_EXEC, 1001, 1001)))
+	assert.True(t, c.matched[1001])
+	assert.NotNil(t, handle(newTestProcEvent(_PROC_EVENT_EXIT, 1001, 1001, 0, 17)))
+}
@@ -2,35 +2,86 @@ package monitor
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/charmbracelet/log"
 	ps "github.com/shirou/gopsutil/v3/process"
 )
 
 type ProcessOptions struct {
-	IncludeHashes bool `json:"include_hashes"`
+	IncludeHashes bool         `json:"include_hashes"`
+	HashOptions   *HashOptions `json:"hash_options,omitempty"`
+
+	// IncludeCwd, IncludeSession (i.e. the session ID, process group ID, and controlling terminal), and Environment (the names of the environment variables to include) select optional details of each process, which are more expensive to read.
+	IncludeCwd     bool     `json:"include_cwd,omitempty"`
+	IncludeSession bool     `json:"include_session,omitempty"`
+	Environment    []string `json:"environment,omitempty"`
+
+	// IncludeELF parses the ELF metadata of the executable of each process.
+	IncludeELF bool `json:"include_elf,omitempty"`
+
+	// IncludeModules lists the shared libraries mapped by each process (Linux only), which are hashed along with its executable.
+	IncludeModules bool `json:"include_modules,omitempty"`
+
+	// IncludeAncestors sets the ancestors of each process listed by ListProcesses.
+	IncludeAncestors bool `json:"include_ancestors,omitempty"`
+
+	// IncludeUser includes the details of the user that owns each process (e.g. its name and home directory), whereas its credentials and username are always included.
+	IncludeUser bool `json:"include_user,omitempty"`
 }
 
 func GetDefaultProcessOptions() *ProcessOptions {
 	return &ProcessOptions{
 		IncludeHashes: true,
+		HashOptions:   GetDefaultHashOptions(),
 	}
 }
 
 type Process struct {
+	GUID        string     `json:"guid,omitempty"`
+	ParentGUID  string     `json:"parent_guid,omitempty"`
 	PID         int32      `json:"pid"`
 	PPID        int32      `json:"ppid"`
 	Name        string     `json:"name,omitempty"`
 	Argv        []string   `json:"argv,omitempty"`
 	Argc        int        `json:"argc,omitempty"`
 	CommandLine string     `json:"command_line,omitempty"`
+	Cwd         string     `json:"cwd,omitempty"`
+	SessionId   int32      `json:"session_id,omitempty"`
+	PGID        int32      `json:"pgid,omitempty"`
+	TTY         string     `json:"tty,omitempty"`
+	Username    string     `json:"username,omitempty"`
 	CreateTime  *time.Time `json:"create_time,omitempty"`
 	ExitCode    *int       `json:"exit_code,omitempty"`
 	Executable  *File      `json:"executable,omitempty"`
+
+	// Credentials are the user and group IDs of the process, and User is its (real) owner.
+	Credentials *ProcessCredentials `json:"credentials,omitempty"`
+	User        *User               `json:"user,omitempty"`
+
+	// Cgroup is the path to the cgroup of the process, which is used to identify the container it's running in (Linux only).
+	Cgroup           string             `json:"cgroup,omitempty"`
+	ContainerId      string             `json:"container_id,omitempty"`
+	ContainerRuntime string             `json:"container_runtime,omitempty"`
+	Namespaces       *ProcessNamespaces `json:"namespaces,omitempty"`
+
+	// Environment only includes the variables selected by ProcessOptions.Environment.
+	Environment map[string]string `json:"environment,omitempty"`
+
+	// Modules are the shared libraries mapped by the process when it was read (see ProcessOptions.IncludeModules).
+	Modules []Module `json:"modules,omitempty"`
+
+	// Ancestors are the parent, grandparent, etc. of the process (see AuditMonitorOptions.IncludeAncestors).
+	Ancestors []ProcessAncestor `json:"ancestors,omitempty"`
 }
 
+// Hash returns a hash of the GUID of the process.
+//
+// Deprecated: use GUID, which is stable across restarts of the monitor.
 func (p Process) Hash() uint64 {
-	return calculateProcessId(p.PID, p.PPID)
+	return GetXXH3([]byte(p.GUID))
 }
 
 func ListProcesses(opts *ProcessOptions) ([]Process, error) {
@@ -41,18 +92,38 @@ func ListProcesses(opts *ProcessOptions) ([]Process, error) {
 	if err != nil {
 		return nil, err
 	}
+	ids, err := listProcessIdentities()
+	if err != nil {
+		return nil, err
+	}
+	getIdentity := getProcessIdentitiesByPid(ids)
+
 	var results []Process
 	for _, p := range processes {
 		process := parseProcess(p)
+		setProcessGUIDs(&process, getIdentity)
+		setProcessDetails(&process, opts)
 		if opts.IncludeHashes && process.Executable != nil {
-			hashes, err := GetFileHashes(process.Executable.Path)
+			// The executable of a running process may have been deleted or be unreadable, which shouldn't prevent the other processes from being listed.
+			hashes, err := GetCachedFileHashes(process.Executable.Path, opts.HashOptions)
 			if err != nil {
-				return nil, err
+				log.Debugf("Failed to hash executable: %v (path: %s)", err, process.Executable.Path)
 			}
 			process.Executable.Hashes = hashes
+			hashModules(process.Modules, opts.HashOptions)
 		}
 		results = append(results, process)
 	}
+	if opts.IncludeAncestors {
+		tree := NewProcessTreeFromProcessIdentities(ids)
+		cache := newProcessCache(len(results) + 1)
+		for i := range results {
+			cache.Add(&results[i])
+		}
+		for i := range results {
+			results[i].Ancestors = cache.GetAncestors(results[i].PID, tree)
+		}
+	}
 	return results, nil
 }
 
@@ -65,16 +136,27 @@ func GetProcess(pid int32, opts *ProcessOptions) (*Process, error) {
 		return nil, err
 	}
 	process := parseProcess(p)
+	setProcessGUIDs(&process, getProcessIdentity)
+	setProcessDetails(&process, opts)
 	if opts.IncludeHashes && process.Executable != nil {
-		hashes, err := GetFileHashes(process.Executable.Path)
+		hashes, err := GetCachedFileHashes(process.Executable.Path, opts.HashOptions)
 		if err != nil {
 			return nil, err
 		}
 		process.Executable.Hashes = hashes
+		hashModules(process.Modules, opts.HashOptions)
 	}
 	return &process, nil
 }
 
+func getProcessName(pid int32) (string, error) {
+	p, err := ps.NewProcess(pid)
+	if err != nil {
+		return "", err
+	}
+	return p.Name()
+}
+
 func parseProcess(p *ps.Process) Process {
 	pid := p.Pid
 	ppid, _ := p.Ppid()
@@ -83,7 +165,8 @@ func parseProcess(p *ps.Process) Process {
 	var executable *File
 	executablePath, _ := p.Exe()
 	if executablePath != "" {
-		executable, _ = GetFile(executablePath)
+		file := NewFile(executablePath)
+		executable = &file
 	}
 
 	argv, _ := p.CmdlineSlice()
@@ -106,19 +189,158 @@ func parseProcess(p *ps.Process) Process {
 		CreateTime:  createTime,
 		Executable:  executable,
 	}
+	// The username is looked up using the user cache (see setProcessCredentials), unless the credentials of processes can't be read on this platform.
+	creds, err := getProcessCredentials(pid)
+	if err == nil {
+		setProcessCredentials(&process, creds)
+	} else {
+		process.Username, _ = p.Username()
+	}
+	setProcessContainer(&process)
 	return process
 }
 
+type processSession struct {
+	SessionId      int32
+	ProcessGroupId int32
+	TTY            string
+}
+
+// setProcessDetails sets the optional details of a process selected by the options.
+func setProcessDetails(p *Process, opts *ProcessOptions) {
+	if opts.IncludeUser && p.User == nil && p.Credentials != nil {
+		p.User = lookupUser(p.Credentials.RUID)
+	}
+	if opts.IncludeCwd && p.Cwd == "" {
+		proc, err := ps.NewProcess(p.PID)
+		if err == nil {
+			p.Cwd, _ = proc.Cwd()
+		}
+	}
+	if opts.IncludeSession {
+		session, err := getProcessSession(p.PID)
+		if err == nil {
+			p.SessionId = session.SessionId
+			p.PGID = session.ProcessGroupId
+			p.TTY = session.TTY
+		}
+	}
+	if len(opts.Environment) > 0 {
+		env, err := getProcessEnvironment(p.PID)
+		if err == nil {
+			p.Environment = filterEnvironment(env, opts.Environment)
+		}
+	}
+	if opts.IncludeELF && p.Executable != nil && p.Executable.ELF == nil {
+		e, err := GetCachedELF(p.Executable.Path, opts.HashOptions)
+		if err != nil {
+			log.Debugf("Failed to parse executable: %v (path: %s)", err, p.Executable.Path)
+		}
+		p.Executable.ELF = e
+	}
+	if opts.IncludeModules && p.Modules == nil {
+		modules, err := getProcessModules(p.PID, nil)
+		if err == nil {
+			p.Modules = modules
+		}
+	}
+}
+
+// filterEnvironment returns the variables with the given names from a list of KEY=VALUE pairs.
+func filterEnvironment(env []string, names []string) map[string]string {
+	var vars map[string]string
+	for _, kv := range env {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !slices.Contains(names, k) {
+			continue
+		}
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		vars[k] = v
+	}
+	return vars
+}
+
 type ProcessIdentity struct {
 	PID  int32 `json:"pid"`
 	PPID int32 `json:"ppid"`
+
+	// StartTime is the process start time as reported by the kernel (e.g. clock ticks since boot on Linux), or 0 if unknown.
+	StartTime uint64 `json:"start_time,omitempty"`
+}
+
+func (p ProcessIdentity) key() processKey {
+	return processKey{
+		pid:       p.PID,
+		startTime: p.StartTime,
+	}
 }
 
+// GUID returns a stable identifier for the process which (unlike the PID) isn't reused, or an empty string if the start time of the process is unknown.
+func (p ProcessIdentity) GUID() string {
+	t := p.CreateTime()
+	if t == nil {
+		return ""
+	}
+	return calculateProcessGUID(p.PID, *t)
+}
+
+// Hash returns a hash of the GUID of the process.
+//
+// Deprecated: use GUID, which is stable across restarts of the monitor.
 func (p ProcessIdentity) Hash() uint64 {
-	return calculateProcessId(p.PID, p.PPID)
+	return GetXXH3([]byte(p.GUID()))
 }
 
-func calculateProcessId(pid, ppid int32) uint64 {
-	k := []byte(fmt.Sprintf("%d,%d", pid, ppid))
-	return GetXXH3(k)
+func (p ProcessIdentity) CreateTime() *time.Time {
+	if p.StartTime == 0 {
+		return nil
+	}
+	t, err := startTimeToCreateTime(p.StartTime)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// processKey uniquely identifies a process on the current host without the cost of calculating its GUID.
+type processKey struct {
+	pid       int32
+	startTime uint64
+}
+
+func calculateProcessGUID(pid int32, createTime time.Time) string {
+	k := []byte(fmt.Sprintf("%d,%d", pid, createTime.UnixMilli()))
+	return NewUUID5(GetHostId(), k)
+}
+
+// setProcessGUIDs sets the GUID, parent GUID, and create time of a process which is still running.
+func setProcessGUIDs(p *Process, getIdentity func(pid int32) (*ProcessIdentity, error)) {
+	id, err := getIdentity(p.PID)
+	if err != nil || id.PPID != p.PPID {
+		return
+	}
+	p.GUID = id.GUID()
+	if t := id.CreateTime(); t != nil {
+		p.CreateTime = t
+	}
+	parent, err := getIdentity(p.PPID)
+	if err == nil {
+		p.ParentGUID = parent.GUID()
+	}
+}
+
+func getProcessIdentitiesByPid(ids []ProcessIdentity) func(pid int32) (*ProcessIdentity, error) {
+	m := make(map[int32]*ProcessIdentity, len(ids))
+	for i := range ids {
+		m[ids[i].PID] = &ids[i]
+	}
+	return func(pid int32) (*ProcessIdentity, error) {
+		id, ok := m[pid]
+		if !ok {
+			return nil, fmt.Errorf("process not found (PID: %d)", pid)
+		}
+		return id, nil
+	}
 }
@@ -3,12 +3,16 @@ package monitor
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"syscall"
+	"time"
 	"unsafe"
+
+	ps "github.com/shirou/gopsutil/v3/process"
 )
 
 func listProcessIdentities() ([]ProcessIdentity, error) {
-	buf, err := darwinListPidsSyscall()
+	buf, err := darwinKinfoProcSyscall(_KERN_PROC_ALL, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -21,16 +25,36 @@ func listProcessIdentities() ([]ProcessIdentity, error) {
 			return nil, err
 		}
 		k = i
-		ids = append(ids, ProcessIdentity{
-			PID:  proc.PID,
-			PPID: proc.PPID,
-		})
+		ids = append(ids, proc.identity())
 	}
 	return ids, nil
 }
 
-func darwinListPidsSyscall() (*bytes.Buffer, error) {
-	mib := [4]int32{_CTRL_KERN, _KERN_PROC, _KERN_PROC_ALL, 0}
+func getProcessIdentity(pid int32) (*ProcessIdentity, error) {
+	buf, err := darwinKinfoProcSyscall(_KERN_PROC_PID, pid)
+	if err != nil {
+		return nil, err
+	}
+	if buf.Len() < _KINFO_STRUCT_SIZE {
+		return nil, errors.New("process not found")
+	}
+	proc := &kinfoProc{}
+	err = binary.Read(bytes.NewBuffer(buf.Bytes()[:_KINFO_STRUCT_SIZE]), binary.LittleEndian, proc)
+	if err != nil {
+		return nil, err
+	}
+	id := proc.identity()
+	return &id, nil
+}
+
+// startTimeToCreateTime converts the start time of a process (in microseconds since the epoch) to a time.
+func startTimeToCreateTime(startTime uint64) (*time.Time, error) {
+	t := time.UnixMicro(int64(startTime))
+	return &t, nil
+}
+
+func darwinKinfoProcSyscall(op, arg int32) (*bytes.Buffer, error) {
+	mib := [4]int32{_CTRL_KERN, _KERN_PROC, op, arg}
 	size := uintptr(0)
 
 	_, _, errno := syscall.Syscall6(
@@ -46,6 +70,9 @@ func darwinListPidsSyscall() (*bytes.Buffer, error) {
 		return nil, errno
 	}
 
+	if size == 0 {
+		return &bytes.Buffer{}, nil
+	}
 	bs := make([]byte, size)
 	_, _, errno = syscall.Syscall6(
 		syscall.SYS___SYSCTL,
@@ -67,14 +94,79 @@ const (
 	_CTRL_KERN         = 1
 	_KERN_PROC         = 14
 	_KERN_PROC_ALL     = 0
+	_KERN_PROC_PID     = 1
 	_KINFO_STRUCT_SIZE = 648
 )
 
 type kinfoProc struct {
-	_    [40]byte
-	PID  int32
-	_    [199]byte
-	_    [317]byte
-	PPID int32
-	_    [84]byte
+	StartSec  int64 // p_starttime.tv_sec
+	StartUsec int32 // p_starttime.tv_usec
+	_         [28]byte
+	PID       int32
+	_         [199]byte
+	_         [317]byte
+	PPID      int32
+	_         [84]byte
+}
+
+func (p kinfoProc) identity() ProcessIdentity {
+	return ProcessIdentity{
+		PID:       p.PID,
+		PPID:      p.PPID,
+		StartTime: uint64(p.StartSec)*1e6 + uint64(p.StartUsec),
+	}
+}
+
+func getProcessCredentials(pid int32) (*ProcessCredentials, error) {
+	p, err := ps.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := p.Uids()
+	if err != nil {
+		return nil, err
+	}
+	gids, err := p.Gids()
+	if err != nil {
+		return nil, err
+	}
+	if len(uids) < 3 || len(gids) < 3 {
+		return nil, errors.New("missing user or group IDs")
+	}
+	creds := &ProcessCredentials{
+		RUID: uint32(uids[0]),
+		EUID: uint32(uids[1]),
+		SUID: uint32(uids[2]),
+		RGID: uint32(gids[0]),
+		EGID: uint32(gids[1]),
+		SGID: uint32(gids[2]),
+	}
+	groups, _ := p.Groups()
+	for _, gid := range groups {
+		creds.Groups = append(creds.Groups, Group{GID: uint32(gid)})
+	}
+	return creds, nil
+}
+
+func getProcessSession(pid int32) (*processSession, error) {
+	sid, err := syscall.Getsid(int(pid))
+	if err != nil {
+		return nil, err
+	}
+	pgid, err := syscall.Getpgid(int(pid))
+	if err != nil {
+		return nil, err
+	}
+	return &processSession{
+		SessionId:      int32(sid),
+		ProcessGroupId: int32(pgid),
+	}, nil
+}
+
+func getProcessEnvironment(pid int32) ([]string, error) {
+	p, err := ps.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	return p.Environ()
 }
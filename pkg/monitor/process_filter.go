@@ -1,10 +1,302 @@
 package monitor
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+	"github.com/whitfieldsdad/go-audit/pkg/util"
+)
+
 type ProcessFilter struct {
 	PIDs         []int32 `json:"pids"`
 	AncestorPIDs []int32 `json:"ancestor_pids"`
+
+	// Users selects the processes owned by any of the given users (by username or UID).
+	Users []string `json:"users,omitempty"`
+
+	// ContainerIds selects the processes running in any of the given containers (by ID or ID prefix).
+	ContainerIds []string `json:"container_ids,omitempty"`
+
+	// Cgroups selects the processes in any of the given cgroups or their descendants (e.g. /kubepods.slice).
+	Cgroups []string `json:"cgroups,omitempty"`
+
+	// Include selects the processes which match any of the given rules. If empty, all processes are included.
+	Include []*ProcessRule `json:"include,omitempty"`
+
+	// Exclude rejects the processes which match any of the given rules, even if they're included.
+	Exclude []*ProcessRule `json:"exclude,omitempty"`
+}
+
+// ProcessRule matches processes which satisfy all of its (non-empty) conditions.
+type ProcessRule struct {
+	// Name is a glob matched against the name of the process.
+	Name string `json:"name,omitempty"`
+
+	// Executable is a glob matched against the path to the executable of the process (e.g. /opt/agent/**).
+	Executable string `json:"executable,omitempty"`
+
+	// Argv is a regular expression matched against the command line of the process.
+	Argv string `json:"argv,omitempty"`
+
+	// User is the name or UID of the user that owns the process.
+	User string `json:"user,omitempty"`
+
+	// ParentName is a glob matched against the name of the parent process.
+	ParentName string `json:"parent_name,omitempty"`
+
+	// Hash is an MD5, SHA-1, SHA-256, SHA-512, or BLAKE3 hash of the executable of the process. Executables larger than HashOptions.MaxSize never match, since only their head and tail are hashed.
+	Hash string `json:"hash,omitempty"`
+
+	name       *regexp.Regexp
+	executable *regexp.Regexp
+	argv       *regexp.Regexp
+	parentName *regexp.Regexp
+}
+
+func ReadProcessFilterFile(path string) (*ProcessFilter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &ProcessFilter{}
+	err = json.Unmarshal(b, f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse process filter")
+	}
+	err = f.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ParseProcessRule parses a rule with a single condition of the form <field>=<value> (e.g. parent_name=datadog-agent).
+func ParseProcessRule(s string) (*ProcessRule, error) {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || v == "" {
+		return nil, fmt.Errorf("invalid rule: %s (expected <field>=<value>)", s)
+	}
+	r := &ProcessRule{}
+	switch strings.TrimSpace(k) {
+	case "name":
+		r.Name = v
+	case "exe", "executable":
+		r.Executable = v
+	case "argv":
+		r.Argv = v
+	case "user":
+		r.User = v
+	case "parent_name":
+		r.ParentName = v
+	case "hash":
+		r.Hash = v
+	default:
+		return nil, fmt.Errorf("invalid rule: %s (unsupported field: %s)", s, k)
+	}
+	err := r.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 func (f ProcessFilter) IsEmpty() bool {
-	return len(f.PIDs) == 0 && len(f.AncestorPIDs) == 0
+	return len(f.PIDs) == 0 && len(f.AncestorPIDs) == 0 && len(f.Users) == 0 && len(f.ContainerIds) == 0 && len(f.Cgroups) == 0 && len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Compile validates and compiles the globs and regular expressions used by the filter's rules.
+func (f *ProcessFilter) Compile() error {
+	for _, r := range f.rules() {
+		err := r.Compile()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *ProcessFilter) rules() []*ProcessRule {
+	return append(slices.Clone(f.Include), f.Exclude...)
+}
+
+func (f *ProcessFilter) hasRules() bool {
+	return f != nil && (len(f.Users) > 0 || len(f.ContainerIds) > 0 || len(f.Cgroups) > 0 || len(f.Include) > 0 || len(f.Exclude) > 0)
+}
+
+// needsHashes returns true if the filter can only be evaluated if the executable of each process has been hashed.
+func (f *ProcessFilter) needsHashes() bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.rules() {
+		if r.Hash != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ProcessFilter) needsParent() bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.rules() {
+		if r.ParentName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesPID evaluates the PIDs and AncestorPIDs conditions of the filter. The tree is only required if AncestorPIDs is set.
+func (f *ProcessFilter) MatchesPID(pid int32, tree *ProcessTree) bool {
+	if f == nil {
+		return true
+	}
+	if f.PIDs != nil && !slices.Contains(f.PIDs, pid) {
+		return false
+	}
+	if len(f.AncestorPIDs) > 0 && (tree == nil || !tree.IsDescendantOfAny(pid, f.AncestorPIDs)) {
+		return false
+	}
+	return true
+}
+
+// MatchesProcess evaluates the users, containers, cgroups, include, and exclude rules of the filter. The parent is only required by rules that use ParentName.
+func (f *ProcessFilter) MatchesProcess(p *Process, parent *Process) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Users) > 0 && !slices.ContainsFunc(f.Users, func(u string) bool { return matchesUser(p, u) }) {
+		return false
+	}
+	if len(f.ContainerIds) > 0 && !slices.ContainsFunc(f.ContainerIds, func(id string) bool { return matchesContainer(p, id) }) {
+		return false
+	}
+	if len(f.Cgroups) > 0 && !slices.ContainsFunc(f.Cgroups, func(cgroup string) bool { return matchesCgroup(p, cgroup) }) {
+		return false
+	}
+	if len(f.Include) > 0 {
+		included := false
+		for _, r := range f.Include {
+			if r.Matches(p, parent) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, r := range f.Exclude {
+		if r.Matches(p, parent) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterProcesses returns the processes which match the filter, hashing their executables with the given options if required (nil for the defaults). The tree is only required if AncestorPIDs is set.
+func (f *ProcessFilter) FilterProcesses(processes []Process, tree *ProcessTree, opts *HashOptions) []Process {
+	byPid := make(map[int32]*Process, len(processes))
+	for i := range processes {
+		byPid[processes[i].PID] = &processes[i]
+	}
+	var results []Process
+	for _, p := range processes {
+		if !f.MatchesPID(p.PID, tree) {
+			continue
+		}
+		if f.needsHashes() && p.Executable != nil && p.Executable.Hashes == nil {
+			hashes, err := GetCachedFileHashes(p.Executable.Path, opts)
+			if err == nil {
+				p.Executable = p.Executable.withHashes(hashes)
+			}
+		}
+		if f.MatchesProcess(&p, byPid[p.PPID]) {
+			results = append(results, p)
+		}
+	}
+	return results
+}
+
+func (r *ProcessRule) Compile() error {
+	var err error
+	r.name, err = compileGlob(r.Name)
+	if err != nil {
+		return err
+	}
+	r.executable, err = compileGlob(r.Executable)
+	if err != nil {
+		return err
+	}
+	r.parentName, err = compileGlob(r.ParentName)
+	if err != nil {
+		return err
+	}
+	if r.Argv != "" {
+		r.argv, err = regexp.Compile(r.Argv)
+		if err != nil {
+			return errors.Wrapf(err, "invalid regular expression: %s", r.Argv)
+		}
+	}
+	return nil
+}
+
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := util.CompileGlob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid glob: %s", pattern)
+	}
+	return re, nil
+}
+
+func (r *ProcessRule) Matches(p *Process, parent *Process) bool {
+	// Conditions which haven't been compiled never match.
+	if r.Name != "" && (r.name == nil || !r.name.MatchString(p.Name)) {
+		return false
+	}
+	if r.Executable != "" && (r.executable == nil || p.Executable == nil || !r.executable.MatchString(p.Executable.Path)) {
+		return false
+	}
+	if r.Argv != "" && (r.argv == nil || !r.argv.MatchString(p.CommandLine)) {
+		return false
+	}
+	if r.User != "" && !matchesUser(p, r.User) {
+		return false
+	}
+	if r.ParentName != "" && (r.parentName == nil || parent == nil || !r.parentName.MatchString(parent.Name)) {
+		return false
+	}
+	if r.Hash != "" && !matchesHash(p.Executable, r.Hash) {
+		return false
+	}
+	return true
+}
+
+func matchesHash(f *File, hash string) bool {
+	if f == nil || f.Hashes == nil {
+		return false
+	}
+	if f.Hashes.Mode == HashModeHeadTail {
+		// A hash of part of a file can't be compared to the hash of a whole file.
+		log.Debugf("Not matching hash of partially hashed file (path: %s)", f.Path)
+		return false
+	}
+	h := f.Hashes
+	for _, v := range []string{h.MD5, h.SHA1, h.SHA256, h.SHA512, h.BLAKE3} {
+		if v != "" && strings.EqualFold(hash, v) {
+			return true
+		}
+	}
+	return false
 }
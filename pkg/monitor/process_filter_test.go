@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFilterIncludeExclude(t *testing.T) {
+	include, err := ParseProcessRule("exe=/opt/agent/**")
+	assert.Nil(t, err)
+	exclude, err := ParseProcessRule("parent_name=datadog-*")
+	assert.Nil(t, err)
+
+	f := &ProcessFilter{
+		Include: []*ProcessRule{include},
+		Exclude: []*ProcessRule{exclude},
+	}
+	agent := NewFile("/opt/agent/bin/collector")
+	p := &Process{PID: 2, PPID: 1, Name: "collector", Executable: &agent}
+
+	assert.True(t, f.MatchesProcess(p, &Process{PID: 1, Name: "systemd"}))
+	assert.False(t, f.MatchesProcess(p, &Process{PID: 1, Name: "datadog-agent"}))
+
+	other := NewFile("/usr/bin/collector")
+	p.Executable = &other
+	assert.False(t, f.MatchesProcess(p, nil))
+}
+
+func TestProcessRuleMatches(t *testing.T) {
+	r := &ProcessRule{
+		Name: "python*",
+		Argv: `--config(=|\s)`,
+		User: "root",
+		Hash: "ABCDEF",
+	}
+	assert.Nil(t, r.Compile())
+
+	p := &Process{
+		Name:        "python3",
+		CommandLine: "python3 agent.py --config /etc/agent.yaml",
+		Username:    "root",
+		Executable: &File{
+			Path:   "/usr/bin/python3",
+			Hashes: &Hashes{SHA256: "abcdef"},
+		},
+	}
+	assert.True(t, r.Matches(p, nil))
+
+	// The hash of the head and tail of an executable isn't the hash of the executable.
+	p.Executable.Hashes.Mode = HashModeHeadTail
+	assert.False(t, r.Matches(p, nil))
+	p.Executable.Hashes.Mode = HashModeFull
+
+	p.Username = "nobody"
+	assert.False(t, r.Matches(p, nil))
+}
+
+func TestParseProcessRuleInvalid(t *testing.T) {
+	for _, s := range []string{"name", "name=", "color=red", "argv=("} {
+		_, err := ParseProcessRule(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestProcessFilterMatchesPID(t *testing.T) {
+	tree := NewProcessTree()
+	tree.AddProcess(1, 2)
+	tree.AddProcess(2, 3)
+
+	f := &ProcessFilter{AncestorPIDs: []int32{2}}
+	assert.True(t, f.MatchesPID(3, tree))
+	assert.False(t, f.MatchesPID(2, tree))
+	assert.False(t, f.MatchesPID(3, nil))
+}
+
+func TestFilterProcesses(t *testing.T) {
+	tree := NewProcessTree()
+	tree.AddProcess(1, 2)
+	tree.AddProcess(2, 3)
+	tree.AddProcess(2, 4)
+	processes := []Process{
+		{PID: 2, PPID: 1, Name: "sshd"},
+		{PID: 3, PPID: 2, Name: "bash"},
+		{PID: 4, PPID: 2, Name: "sftp-server"},
+	}
+
+	r, err := ParseProcessRule("parent_name=sshd")
+	assert.Nil(t, err)
+	f := &ProcessFilter{AncestorPIDs: []int32{1}, Exclude: []*ProcessRule{{Name: "sftp-*"}}, Include: []*ProcessRule{r}}
+	assert.Nil(t, f.Compile())
+
+	matched := f.FilterProcesses(processes, tree, nil)
+	assert.Len(t, matched, 1)
+	assert.Equal(t, int32(3), matched[0].PID)
+}
+
+func TestFilterProcessesHashOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exe")
+	assert.Nil(t, os.WriteFile(path, make([]byte, 100), 0755))
+	hashes, err := GetFileHashesWithOptions(path, nil)
+	assert.Nil(t, err)
+	f := &ProcessFilter{Include: []*ProcessRule{{Hash: hashes.SHA256}}}
+	assert.Nil(t, f.Compile())
+	exe := NewFile(path)
+	processes := []Process{{PID: 1, Executable: &exe}}
+	assert.Len(t, f.FilterProcesses(processes, nil, nil), 1)
+
+	// The executables are hashed using the given options, so only their head and tail are hashed if they're too large.
+	opts := &HashOptions{Algorithms: []string{HashSHA256}, MaxSize: 10, PartialSize: 4}
+	assert.Empty(t, f.FilterProcesses(processes, nil, opts))
+	_, ok := getCachedFileHashes(path, opts)
+	assert.True(t, ok)
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"github.com/charmbracelet/log"
+	lru "github.com/hashicorp/golang-lru"
+	ps "github.com/shirou/gopsutil/v3/process"
+)
+
+var (
+	ProcessCacheSize = 8192
+)
+
+type ProcessAncestor struct {
+	GUID        string `json:"guid,omitempty"`
+	PID         int32  `json:"pid"`
+	Name        string `json:"name,omitempty"`
+	Executable  string `json:"executable,omitempty"`
+	CommandLine string `json:"command_line,omitempty"`
+}
+
+func newProcessAncestor(p *Process) ProcessAncestor {
+	a := ProcessAncestor{
+		GUID:        p.GUID,
+		PID:         p.PID,
+		Name:        p.Name,
+		CommandLine: p.CommandLine,
+	}
+	if p.Executable != nil {
+		a.Executable = p.Executable.Path
+	}
+	return a
+}
+
+// processCache remembers the processes we've seen by PID, so that the lineage of a process can be resolved after its ancestors have exited.
+type processCache struct {
+	processes *lru.Cache
+}
+
+func newProcessCache(size int) *processCache {
+	processes, err := lru.New(size)
+	if err != nil {
+		log.Fatalf("Failed to create process cache: %v", err)
+	}
+	return &processCache{processes: processes}
+}
+
+func (c *processCache) Add(p *Process) {
+	c.processes.Add(p.PID, newProcessAncestor(p))
+}
+
+// Forget removes a process from the cache (e.g. because its PID has been reused by a process we didn't read the details of).
+func (c *processCache) Forget(pid int32) {
+	c.processes.Remove(pid)
+}
+
+func (c *processCache) Get(pid int32) (ProcessAncestor, bool) {
+	v, ok := c.processes.Get(pid)
+	if ok {
+		return v.(ProcessAncestor), true
+	}
+	// The process may have been started before we were.
+	a, err := getProcessAncestor(pid)
+	if err != nil {
+		return ProcessAncestor{PID: pid}, false
+	}
+	c.processes.Add(pid, *a)
+	return *a, true
+}
+
+func getProcessAncestor(pid int32) (*ProcessAncestor, error) {
+	p, err := ps.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	a := &ProcessAncestor{PID: pid}
+	a.Name, _ = p.Name()
+	a.Executable, _ = p.Exe()
+	a.CommandLine, _ = p.Cmdline()
+	if id, err := getProcessIdentity(pid); err == nil {
+		a.GUID = id.GUID()
+	}
+	return a, nil
+}
+
+// GetAncestors returns the ancestors of a process from its parent to the root of the tree, using the cache to describe each of them.
+func (c *processCache) GetAncestors(pid int32, tree *ProcessTree) []ProcessAncestor {
+	pids := tree.GetAncestorPids(pid)
+	ancestors := make([]ProcessAncestor, 0, len(pids))
+	for _, ppid := range pids {
+		if ppid <= 0 {
+			break
+		}
+		a, _ := c.Get(ppid)
+		ancestors = append(ancestors, a)
+	}
+	return ancestors
+}
+
+// cacheProcess records the details of a process so that it can be described as an ancestor of its descendants.
+func (m *AuditMonitor) cacheProcess(p *Process) {
+	if m.processes != nil {
+		m.processes.Add(p)
+	}
+}
+
+// forgetProcess is called when a new process is started, so that a process which has reused the PID of an exited process isn't mistaken for it.
+func (m *AuditMonitor) forgetProcess(pid int32) {
+	if m.processes != nil {
+		m.processes.Forget(pid)
+	}
+}
+
+// setAncestors sets the ancestors of a process if required (the process cache is also used by other features, e.g. to describe the process which accessed a file).
+func (m *AuditMonitor) setAncestors(p *Process, tree *ProcessTree) {
+	if !m.Options.IncludeAncestors || m.processes == nil || tree == nil {
+		return
+	}
+	p.Ancestors = m.processes.GetAncestors(p.PID, tree)
+}
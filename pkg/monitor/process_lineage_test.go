@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAncestors(t *testing.T) {
+	tree := NewProcessTree()
+	tree.AddProcess(0, 1)
+	tree.AddProcess(1, 100)
+	tree.AddProcess(100, 200)
+	tree.AddProcess(200, 300)
+
+	// The parent has exited, but it's still described by the cache.
+	tree.ExitProcess(200)
+	c := newProcessCache(10)
+	c.Add(&Process{PID: 200, Name: "bash", CommandLine: "bash -c id", Executable: &File{Path: "/bin/bash"}})
+	c.Add(&Process{PID: 100, Name: "sshd"})
+	c.Add(&Process{PID: 1, Name: "init"})
+
+	ancestors := c.GetAncestors(300, tree)
+	assert.Equal(t, []ProcessAncestor{
+		{PID: 200, Name: "bash", Executable: "/bin/bash", CommandLine: "bash -c id"},
+		{PID: 100, Name: "sshd"},
+		{PID: 1, Name: "init"},
+	}, ancestors)
+
+	// Once a PID is reused, the process which exited is forgotten.
+	c.Forget(100)
+	_, ok := c.processes.Get(int32(100))
+	assert.False(t, ok)
+}
+
+func TestSetAncestors(t *testing.T) {
+	tree := NewProcessTree()
+	tree.AddProcess(1, 100)
+
+	// The process cache is also used to describe the processes which access files, so ancestors are only included if requested.
+	opts := GetDefaultAuditMonitorOptions()
+	opts.Files = GetDefaultFileMonitorOptions()
+	opts.Files.Backend = FileBackendFanotify
+	opts.Files.Paths = []string{t.TempDir()}
+	m, err := NewAuditMonitor(nil, opts)
+	assert.Nil(t, err)
+	assert.NotNil(t, m.processes)
+	m.cacheProcess(&Process{PID: 1, Name: "init"})
+	p := &Process{PID: 100}
+	m.setAncestors(p, tree)
+	assert.Nil(t, p.Ancestors)
+
+	m.Options.IncludeAncestors = true
+	m.setAncestors(p, tree)
+	assert.Equal(t, []ProcessAncestor{{PID: 1, Name: "init"}}, p.Ancestors)
+}
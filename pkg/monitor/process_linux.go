@@ -0,0 +1,309 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var procRoot = "/proc"
+
+// clockTicks is USER_HZ, the unit of the time fields in /proc/<pid>/stat, which is fixed at 100 on all supported architectures.
+const clockTicks = 100
+
+// procStatBufferSize is large enough to hold any /proc/<pid>/stat line (52 numeric fields plus a 16 byte comm).
+const procStatBufferSize = 4096
+
+type procStat struct {
+	PID       int32
+	PPID      int32
+	Comm      string
+	State     byte
+	PGRP      int32
+	Session   int32
+	TTY       uint32
+	StartTime uint64
+}
+
+func listProcessIdentities() ([]ProcessIdentity, error) {
+	pids, err := listPids()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, procStatBufferSize)
+	ids := make([]ProcessIdentity, 0, len(pids))
+	for _, pid := range pids {
+		stat, err := readProcStat(pid, buf)
+		if err != nil {
+			// The process exited between listing /proc and reading its stat file.
+			continue
+		}
+		ids = append(ids, ProcessIdentity{
+			PID:       stat.PID,
+			PPID:      stat.PPID,
+			StartTime: stat.StartTime,
+		})
+	}
+	return ids, nil
+}
+
+func listPids() ([]int32, error) {
+	d, err := os.Open(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int32, 0, len(names))
+	for _, name := range names {
+		if name[0] < '0' || name[0] > '9' {
+			continue
+		}
+		pid, err := strconv.ParseInt(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		pids = append(pids, int32(pid))
+	}
+	return pids, nil
+}
+
+// readProcStat reads /proc/<pid>/stat into buf, which is reused between calls to avoid allocating on every poll.
+func readProcStat(pid int32, buf []byte) (*procStat, error) {
+	f, err := os.Open(procPath(pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	n, err := f.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return parseProcStat(buf[:n])
+}
+
+// parseProcStat parses the contents of /proc/<pid>/stat (see proc(5)).
+func parseProcStat(b []byte) (*procStat, error) {
+	// The comm field is wrapped in parentheses and may itself contain spaces and parentheses, so we split on the last ')'.
+	start := bytes.IndexByte(b, '(')
+	end := bytes.LastIndexByte(b, ')')
+	if start < 0 || end < start {
+		return nil, errors.New("malformed stat: missing comm")
+	}
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(b[:start])), 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed stat: invalid pid")
+	}
+	stat := &procStat{
+		PID:  int32(pid),
+		Comm: string(b[start+1 : end]),
+	}
+
+	// Fields following comm, starting with field 3 (state).
+	fields := bytes.Fields(b[end+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("malformed stat: expected at least 22 fields, got %d", len(fields)+2)
+	}
+	stat.State = fields[0][0]
+
+	ppid, err := strconv.ParseInt(string(fields[1]), 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed stat: invalid ppid")
+	}
+	stat.PPID = int32(ppid)
+
+	pgrp, err := strconv.ParseInt(string(fields[2]), 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed stat: invalid pgrp")
+	}
+	stat.PGRP = int32(pgrp)
+
+	session, err := strconv.ParseInt(string(fields[3]), 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed stat: invalid session")
+	}
+	stat.Session = int32(session)
+
+	tty, err := strconv.ParseInt(string(fields[4]), 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed stat: invalid tty_nr")
+	}
+	stat.TTY = uint32(tty)
+
+	stat.StartTime, err = strconv.ParseUint(string(fields[19]), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed stat: invalid start time")
+	}
+	return stat, nil
+}
+
+func getProcessIdentity(pid int32) (*ProcessIdentity, error) {
+	stat, err := readProcStat(pid, make([]byte, procStatBufferSize))
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessIdentity{
+		PID:       stat.PID,
+		PPID:      stat.PPID,
+		StartTime: stat.StartTime,
+	}, nil
+}
+
+func procPath(pid int32, elem ...string) string {
+	return filepath.Join(append([]string{procRoot, strconv.Itoa(int(pid))}, elem...)...)
+}
+
+func (s procStat) CreateTime() (*time.Time, error) {
+	return startTimeToCreateTime(s.StartTime)
+}
+
+func startTimeToCreateTime(startTime uint64) (*time.Time, error) {
+	bootTime, err := getBootTime()
+	if err != nil {
+		return nil, err
+	}
+	t := bootTime.Add(time.Duration(startTime) * (time.Second / clockTicks))
+	return &t, nil
+}
+
+var (
+	_bootTime     time.Time
+	_bootTimeErr  error
+	_bootTimeOnce sync.Once
+)
+
+// getBootTime returns the boot time from the btime field of /proc/stat. It's truncated to the second, but unlike the boot time derived from /proc/uptime it doesn't vary between runs, so the create times (and GUIDs) of processes are stable.
+func getBootTime() (time.Time, error) {
+	_bootTimeOnce.Do(func() {
+		_bootTime, _bootTimeErr = readBootTime()
+	})
+	return _bootTime, _bootTimeErr
+}
+
+func readBootTime() (time.Time, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		value, ok := strings.CutPrefix(line, "btime ")
+		if !ok {
+			continue
+		}
+		btime, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "malformed btime")
+		}
+		return time.Unix(btime, 0), nil
+	}
+	return time.Time{}, errors.New("btime not found in /proc/stat")
+}
+
+func getProcessCredentials(pid int32) (*ProcessCredentials, error) {
+	b, err := os.ReadFile(procPath(pid, "status"))
+	if err != nil {
+		return nil, err
+	}
+	return parseProcStatusCredentials(b)
+}
+
+// parseProcStatusCredentials parses the Uid, Gid, and Groups fields of /proc/<pid>/status (see proc(5)).
+func parseProcStatusCredentials(b []byte) (*ProcessCredentials, error) {
+	var uids, gids []uint32
+	creds := &ProcessCredentials{}
+	for _, line := range strings.Split(string(b), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Uid", "Gid", "Groups":
+			ids, err := parseProcStatusIds(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "malformed status: invalid %s", key)
+			}
+			switch key {
+			case "Uid":
+				uids = ids
+			case "Gid":
+				gids = ids
+			case "Groups":
+				for _, gid := range ids {
+					creds.Groups = append(creds.Groups, Group{GID: gid})
+				}
+			}
+		}
+	}
+	// Each of Uid and Gid has the real, effective, saved, and filesystem IDs.
+	if len(uids) < 3 || len(gids) < 3 {
+		return nil, errors.New("malformed status: missing Uid or Gid")
+	}
+	creds.RUID, creds.EUID, creds.SUID = uids[0], uids[1], uids[2]
+	creds.RGID, creds.EGID, creds.SGID = gids[0], gids[1], gids[2]
+	return creds, nil
+}
+
+func parseProcStatusIds(s string) ([]uint32, error) {
+	fields := strings.Fields(s)
+	ids := make([]uint32, 0, len(fields))
+	for _, field := range fields {
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
+
+func getProcessSession(pid int32) (*processSession, error) {
+	stat, err := readProcStat(pid, make([]byte, procStatBufferSize))
+	if err != nil {
+		return nil, err
+	}
+	return &processSession{
+		SessionId:      stat.Session,
+		ProcessGroupId: stat.PGRP,
+		TTY:            getTTYName(stat.TTY),
+	}, nil
+}
+
+// getTTYName returns the path to a terminal given its device number (the tty_nr field of /proc/<pid>/stat), or an empty string if the process has no controlling terminal.
+func getTTYName(tty uint32) string {
+	if tty == 0 {
+		return ""
+	}
+	major := (tty >> 8) & 0xfff
+	minor := (tty & 0xff) | ((tty >> 12) & 0xfff00)
+	switch {
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("/dev/pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("/dev/tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("/dev/ttyS%d", minor-64)
+	case major == 5 && minor == 1:
+		return "/dev/console"
+	}
+	return fmt.Sprintf("tty(%d:%d)", major, minor)
+}
+
+func getProcessEnvironment(pid int32) ([]string, error) {
+	b, err := os.ReadFile(procPath(pid, "environ"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00"), nil
+}
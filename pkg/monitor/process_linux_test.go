@@ -0,0 +1,158 @@
+package monitor
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcStat(t *testing.T) {
+	b := []byte("1234 (my (weird) proc) S 1 1234 1234 0 -1 4194560 1000 0 0 0 12 3 0 0 20 0 1 0 98765 1000000 200 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0\n")
+	stat, err := parseProcStat(b)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1234), stat.PID)
+	assert.Equal(t, int32(1), stat.PPID)
+	assert.Equal(t, "my (weird) proc", stat.Comm)
+	assert.Equal(t, byte('S'), stat.State)
+	assert.Equal(t, int32(1234), stat.PGRP)
+	assert.Equal(t, int32(1234), stat.Session)
+	assert.Equal(t, uint32(0), stat.TTY)
+	assert.Equal(t, uint64(98765), stat.StartTime)
+}
+
+func TestParseProcStatMalformed(t *testing.T) {
+	_, err := parseProcStat([]byte("1234 (truncated) S 1"))
+	assert.NotNil(t, err)
+}
+
+func TestListProcessIdentities(t *testing.T) {
+	ids, err := listProcessIdentities()
+	assert.Nil(t, err)
+
+	pid := int32(os.Getpid())
+	found := false
+	for _, id := range ids {
+		if id.PID == pid {
+			found = true
+			assert.Equal(t, int32(os.Getppid()), id.PPID)
+			assert.NotZero(t, id.StartTime)
+		}
+	}
+	assert.True(t, found, "Failed to find the current process")
+}
+
+func TestProcessIdentityGUID(t *testing.T) {
+	a := ProcessIdentity{PID: 100, PPID: 1, StartTime: 5000}
+	b := ProcessIdentity{PID: 100, PPID: 2, StartTime: 5000}
+	c := ProcessIdentity{PID: 100, PPID: 1, StartTime: 5001}
+	assert.NotEmpty(t, a.GUID())
+	assert.Equal(t, a.GUID(), b.GUID(), "The GUID of a process shouldn't change when it's reparented")
+	assert.NotEqual(t, a.GUID(), c.GUID(), "A reused PID should have a different GUID")
+	assert.Empty(t, ProcessIdentity{PID: 100}.GUID())
+	assert.Equal(t, a.Hash(), Process{GUID: a.GUID()}.Hash())
+	assert.NotEqual(t, a.Hash(), c.Hash())
+}
+
+func TestGetProcessGUID(t *testing.T) {
+	pid := int32(os.Getpid())
+	id, err := getProcessIdentity(pid)
+	assert.Nil(t, err)
+
+	process, err := GetProcess(pid, &ProcessOptions{IncludeHashes: false})
+	assert.Nil(t, err)
+	assert.Equal(t, id.GUID(), process.GUID)
+	assert.NotEmpty(t, process.ParentGUID)
+}
+
+func TestGetProcessSnapshot(t *testing.T) {
+	pid := int32(os.Getpid())
+	f := &ProcessFilter{PIDs: []int32{pid}}
+	events, err := GetProcessSnapshot(f, &ProcessOptions{IncludeAncestors: true})
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+
+	e := events[0]
+	assert.Equal(t, EventType(EventTypeRunning), e.Header.EventType)
+	data := e.Data.(ProcessStartEventData)
+	assert.Equal(t, pid, data.PID)
+	assert.NotEmpty(t, data.GUID)
+	assert.Equal(t, int32(os.Getppid()), data.Ancestors[0].PID)
+}
+
+func TestParseProcStatusCredentials(t *testing.T) {
+	b := []byte("Name:\tsudo\nUmask:\t0022\nState:\tS (sleeping)\nUid:\t1000\t0\t0\t0\nGid:\t1000\t1000\t1000\t1000\nFDSize:\t64\nGroups:\t4 27 1000 \nNStgid:\t1234\n")
+	creds, err := parseProcStatusCredentials(b)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1000), creds.RUID)
+	assert.Equal(t, uint32(0), creds.EUID)
+	assert.Equal(t, uint32(0), creds.SUID)
+	assert.Equal(t, uint32(1000), creds.EGID)
+	assert.Equal(t, []Group{{GID: 4}, {GID: 27}, {GID: 1000}}, creds.Groups)
+
+	_, err = parseProcStatusCredentials([]byte("Name:\tsudo\nUid:\t1000\n"))
+	assert.NotNil(t, err)
+}
+
+func TestGetProcessCredentials(t *testing.T) {
+	p, err := GetProcess(int32(os.Getpid()), &ProcessOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(os.Getuid()), p.Credentials.RUID)
+	assert.Equal(t, uint32(os.Geteuid()), p.Credentials.EUID)
+	assert.NotEmpty(t, p.Username)
+	assert.Nil(t, p.User)
+
+	// The username is looked up using the user cache.
+	users, _ := getUserCaches()
+	assert.True(t, users.Contains(p.Credentials.RUID))
+
+	p, err = GetProcess(int32(os.Getpid()), &ProcessOptions{IncludeUser: true})
+	assert.Nil(t, err)
+	assert.NotNil(t, p.User)
+	assert.Equal(t, p.Username, p.User.Username)
+
+	// A process can be matched by either the name or the UID of its owner.
+	f := &ProcessFilter{Users: []string{p.User.Username}}
+	assert.True(t, f.MatchesProcess(p, nil))
+	f.Users = []string{p.User.UserId}
+	assert.True(t, f.MatchesProcess(p, nil))
+	f.Users = []string{"no-such-user"}
+	assert.False(t, f.MatchesProcess(p, nil))
+}
+
+func TestGetTTYName(t *testing.T) {
+	assert.Equal(t, "", getTTYName(0))
+	assert.Equal(t, "/dev/pts/0", getTTYName(34816))
+	assert.Equal(t, "/dev/pts/300", getTTYName(137<<8|44))
+	assert.Equal(t, "/dev/tty1", getTTYName(1025))
+	assert.Equal(t, "/dev/ttyS0", getTTYName(4<<8|64))
+}
+
+func TestSetProcessDetails(t *testing.T) {
+	// The environment of a process is the one it was started with. The child writes a line once it's running the shell (rather than the test binary it was forked from), and then waits to be killed.
+	cmd := exec.Command("sh", "-c", "echo; read line")
+	cmd.Env = []string{"SUDO_USER=alice", "HOME=/root"}
+	cmd.Dir = t.TempDir()
+	stdin, err := cmd.StdinPipe()
+	assert.Nil(t, err)
+	defer stdin.Close()
+	stdout, err := cmd.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	_, err = bufio.NewReader(stdout).ReadString('\n')
+	assert.Nil(t, err)
+
+	p := &Process{PID: int32(cmd.Process.Pid)}
+	setProcessDetails(p, &ProcessOptions{IncludeCwd: true, IncludeSession: true, Environment: []string{"SUDO_USER", "LD_PRELOAD"}})
+
+	assert.Equal(t, cmd.Dir, p.Cwd)
+	assert.NotZero(t, p.SessionId)
+	assert.NotZero(t, p.PGID)
+	assert.Equal(t, map[string]string{"SUDO_USER": "alice"}, p.Environment)
+}
@@ -1,19 +1,26 @@
 package monitor
 
+// ProcessTree indexes processes by both their parent and their children, so that lookups in either direction don't require scanning every process. It isn't safe for concurrent use.
 type ProcessTree struct {
 	pidToPpid map[int32]int32
+	children  map[int32]map[int32]struct{}
+
+	// Processes which have exited but are kept in the tree because they still have descendants (i.e. so that orphans remain descendants of their original ancestors).
+	exited map[int32]struct{}
 }
 
 func NewProcessTree() *ProcessTree {
 	return &ProcessTree{
 		pidToPpid: make(map[int32]int32),
+		children:  make(map[int32]map[int32]struct{}),
+		exited:    make(map[int32]struct{}),
 	}
 }
 
 func NewProcessTreeFromProcessIdentities(ids []ProcessIdentity) *ProcessTree {
 	t := NewProcessTree()
 	for _, id := range ids {
-		t.pidToPpid[id.PID] = id.PPID
+		t.AddProcess(id.PPID, id.PID)
 	}
 	return t
 }
@@ -26,22 +33,133 @@ func GetProcessTree() (*ProcessTree, error) {
 	return NewProcessTreeFromProcessIdentities(ids), nil
 }
 
+// GetAncestryTree returns a tree containing only the running ancestors of a process, which is cheaper to build than the tree of every process.
+func GetAncestryTree(pid int32) *ProcessTree {
+	t := NewProcessTree()
+	for pid > 0 {
+		if _, ok := t.pidToPpid[pid]; ok {
+			break
+		}
+		id, err := getProcessIdentity(pid)
+		if err != nil {
+			break
+		}
+		t.AddProcess(id.PPID, id.PID)
+		pid = id.PPID
+	}
+	return t
+}
+
 func (t *ProcessTree) AddProcess(ppid, pid int32) error {
-	t.pidToPpid[pid] = ppid
+	if previous, ok := t.pidToPpid[pid]; ok {
+		if _, ok := t.exited[pid]; ok {
+			// The PID has been reused, so the children of the process which exited are adopted by its parent.
+			delete(t.exited, pid)
+			for child := range t.children[pid] {
+				t.setParent(child, previous)
+			}
+			delete(t.children, pid)
+		} else {
+			t.removeChild(previous, pid)
+		}
+	}
+	t.setParent(pid, ppid)
 	return nil
 }
 
+func (t *ProcessTree) setParent(pid, ppid int32) {
+	if previous, ok := t.pidToPpid[pid]; ok {
+		t.removeChild(previous, pid)
+	}
+	t.pidToPpid[pid] = ppid
+	if pid == ppid {
+		return
+	}
+	children, ok := t.children[ppid]
+	if !ok {
+		children = make(map[int32]struct{})
+		t.children[ppid] = children
+	}
+	children[pid] = struct{}{}
+}
+
+func (t *ProcessTree) removeChild(ppid, pid int32) {
+	children, ok := t.children[ppid]
+	if !ok {
+		return
+	}
+	delete(children, pid)
+	if len(children) == 0 {
+		delete(t.children, ppid)
+	}
+}
+
+// RemoveProcesses removes processes from the tree, along with any links to their children.
 func (t *ProcessTree) RemoveProcesses(pids ...int32) {
 	for _, pid := range pids {
+		ppid, ok := t.pidToPpid[pid]
+		if !ok {
+			continue
+		}
+		t.removeChild(ppid, pid)
 		delete(t.pidToPpid, pid)
+		delete(t.exited, pid)
 	}
 }
 
-func (t ProcessTree) GetAncestorPids(pid int32) []int32 {
-	ancestors := []int32{}
+// ExitProcess removes a process which has exited from the tree, unless it still has descendants, in which case it's kept until they've exited too.
+func (t *ProcessTree) ExitProcess(pid int32) {
 	for {
 		ppid, ok := t.pidToPpid[pid]
 		if !ok {
+			return
+		}
+		if len(t.children[pid]) > 0 {
+			t.exited[pid] = struct{}{}
+			return
+		}
+		t.RemoveProcesses(pid)
+
+		// Remove the parent too if it had already exited and this was its last descendant.
+		if _, ok := t.exited[ppid]; !ok || ppid == pid {
+			return
+		}
+		delete(t.exited, ppid)
+		pid = ppid
+	}
+}
+
+// Update applies the differences between two snapshots of the running processes to the tree.
+func (t *ProcessTree) Update(started, exited []ProcessIdentity) {
+	// Processes which exited are removed first in case their PIDs were reused.
+	for _, id := range exited {
+		t.ExitProcess(id.PID)
+	}
+	for _, id := range started {
+		t.AddProcess(id.PPID, id.PID)
+	}
+}
+
+// ApplyEvent updates the tree using a process started or stopped event.
+func (t *ProcessTree) ApplyEvent(e Event) {
+	switch data := e.Data.(type) {
+	case ProcessStartEventData:
+		t.AddProcess(data.PPID, data.PID)
+	case ProcessStopEventData:
+		t.ExitProcess(data.PID)
+	}
+}
+
+// Len returns the number of processes in the tree, including processes which have exited but still have descendants.
+func (t ProcessTree) Len() int {
+	return len(t.pidToPpid)
+}
+
+func (t ProcessTree) GetAncestorPids(pid int32) []int32 {
+	ancestors := []int32{}
+	for len(ancestors) <= len(t.pidToPpid) {
+		ppid, ok := t.pidToPpid[pid]
+		if !ok || ppid == pid {
 			break
 		}
 		ancestors = append(ancestors, ppid)
@@ -52,10 +170,19 @@ func (t ProcessTree) GetAncestorPids(pid int32) []int32 {
 
 func (t ProcessTree) GetDescendantPids(pid int32) []int32 {
 	var descendants []int32
-	children := t.GetChildPids(pid)
-	for _, child := range children {
-		descendants = append(descendants, child)
-		descendants = append(descendants, t.GetDescendantPids(child)...)
+	seen := map[int32]struct{}{pid: {}}
+	queue := []int32{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for child := range t.children[p] {
+			if _, ok := seen[child]; ok {
+				continue
+			}
+			seen[child] = struct{}{}
+			descendants = append(descendants, child)
+			queue = append(queue, child)
+		}
 	}
 	return descendants
 }
@@ -66,11 +193,9 @@ func (t ProcessTree) GetParentPid(pid int32) (int32, bool) {
 }
 
 func (t ProcessTree) GetChildPids(pid int32) []int32 {
-	children := []int32{}
-	for p, parent := range t.pidToPpid {
-		if pid == parent {
-			children = append(children, p)
-		}
+	children := make([]int32, 0, len(t.children[pid]))
+	for child := range t.children[pid] {
+		children = append(children, child)
 	}
 	return children
 }
@@ -91,7 +216,7 @@ func (t ProcessTree) GetSiblingPids(pid int32) []int32 {
 
 func (t ProcessTree) IsDescendantOfAny(pid int32, pids []int32) bool {
 	for _, p := range pids {
-		if t.IsDescendantOf(pid, p) {
+		if t.IsAncestor(pid, p) {
 			return true
 		}
 	}
@@ -99,11 +224,49 @@ func (t ProcessTree) IsDescendantOfAny(pid int32, pids []int32) bool {
 }
 
 func (t ProcessTree) IsDescendantOf(descendantPid, pid int32) bool {
-	descendants := t.GetDescendantPids(pid)
-	for _, descendant := range descendants {
-		if descendant == descendantPid {
+	return t.IsAncestor(descendantPid, pid)
+}
+
+// IsParent returns true if ppid is the parent of pid.
+func (t ProcessTree) IsParent(pid, ppid int32) bool {
+	parent, ok := t.GetParentPid(pid)
+	return ok && pid != ppid && parent == ppid
+}
+
+// IsChild returns true if pid is a child of ppid.
+func (t ProcessTree) IsChild(pid, ppid int32) bool {
+	return t.IsParent(pid, ppid)
+}
+
+func (t ProcessTree) IsSibling(pid, siblingPid int32) bool {
+	if pid == siblingPid {
+		return false
+	}
+	a, ok := t.GetParentPid(pid)
+	if !ok {
+		return false
+	}
+	b, ok := t.GetParentPid(siblingPid)
+	return ok && a == b
+}
+
+// IsAncestor returns true if ancestorPid is an ancestor of pid in O(depth) time.
+func (t ProcessTree) IsAncestor(pid, ancestorPid int32) bool {
+	for depth := 0; depth <= len(t.pidToPpid); depth++ {
+		ppid, ok := t.pidToPpid[pid]
+		if !ok || ppid == pid {
+			return false
+		}
+		if ppid == ancestorPid {
 			return true
 		}
+		pid = ppid
 	}
+	// There's a cycle (e.g. a PID was reused while we weren't looking).
 	return false
 }
+
+// IsDescendant returns true if descendantPid is a descendant of pid.
+func (t ProcessTree) IsDescendant(pid, descendantPid int32) bool {
+	return t.IsAncestor(descendantPid, pid)
+}
@@ -20,7 +20,7 @@ func TestGetAncestorPidsOneBranch(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(3, 4)
 
-	expected := []int{1, 2}
+	expected := []int32{1, 2}
 	result := tree.GetAncestorPids(3)
 	slices.Sort(result)
 	assert.Equal(t, expected, result, "Failed to identify ancestors")
@@ -41,7 +41,7 @@ func TestGetAncestorPidsMultipleBranches(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	expected := []int{1, 5, 8}
+	expected := []int32{1, 5, 8}
 	result := tree.GetAncestorPids(9)
 	slices.Sort(result)
 	assert.Equal(t, expected, result, "Failed to identify ancestors")
@@ -61,7 +61,7 @@ func TestGetDescendantPids(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	expected := []int{6, 7, 8, 9}
+	expected := []int32{6, 7, 8, 9}
 	result := tree.GetDescendantPids(5)
 	slices.Sort(result)
 	assert.Equal(t, expected, result, "GetDescendantPids() should return the correct descendant pids")
@@ -81,7 +81,7 @@ func TestGetSiblingPids(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	expected := []int{8}
+	expected := []int32{8}
 	result := tree.GetSiblingPids(6)
 	slices.Sort(result)
 	assert.Equal(t, expected, result, "GetSiblingPids() should return the correct sibling pids")
@@ -93,7 +93,7 @@ func TestGetParentPid(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	expected := 2
+	expected := int32(2)
 	result, ok := tree.GetParentPid(3)
 	assert.True(t, ok, "GetParentPid() should return true if the pid exists")
 	assert.Equal(t, expected, result, "GetParentPid() should return the correct parent pid")
@@ -109,7 +109,7 @@ func TestGetChildPids(t *testing.T) {
 	tree.AddProcess(2, 5)
 	tree.AddProcess(5, 6)
 
-	expected := []int{3, 5}
+	expected := []int32{3, 5}
 	result := tree.GetChildPids(2)
 	slices.Sort(result)
 	assert.Equal(t, expected, result, "GetChildPids() should return the correct child pids")
@@ -121,8 +121,8 @@ func TestIsParent(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 2
-	ppid := 1
+	pid := int32(2)
+	ppid := int32(1)
 	assert.True(t, tree.IsParent(pid, ppid))
 }
 
@@ -132,8 +132,8 @@ func TestIsParentWithSamePids(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 1
-	ppid := 1
+	pid := int32(1)
+	ppid := int32(1)
 	assert.False(t, tree.IsParent(pid, ppid))
 }
 
@@ -143,8 +143,8 @@ func TestIsParentWithIncorrectParent(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 1
-	ppid := 2
+	pid := int32(1)
+	ppid := int32(2)
 	assert.False(t, tree.IsParent(pid, ppid))
 }
 
@@ -154,8 +154,8 @@ func TestIsParentWithInvalidParent(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 1
-	ppid := 0
+	pid := int32(1)
+	ppid := int32(0)
 	assert.False(t, tree.IsParent(pid, ppid))
 }
 
@@ -165,8 +165,8 @@ func TestIsChild(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 3
-	ppid := 2
+	pid := int32(3)
+	ppid := int32(2)
 	assert.True(t, tree.IsChild(pid, ppid))
 }
 
@@ -176,8 +176,8 @@ func TestIsChildWithSamePids(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 1
-	ppid := 1
+	pid := int32(1)
+	ppid := int32(1)
 	assert.False(t, tree.IsChild(pid, ppid))
 }
 
@@ -187,8 +187,8 @@ func TestIsChildWithIncorrectParent(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 2
-	ppid := 3
+	pid := int32(2)
+	ppid := int32(3)
 	assert.False(t, tree.IsChild(pid, ppid))
 }
 
@@ -198,8 +198,8 @@ func TestIsChildWithInvalidParent(t *testing.T) {
 	tree.AddProcess(1, 2)
 	tree.AddProcess(2, 3)
 
-	pid := 1
-	ppid := 0
+	pid := int32(1)
+	ppid := int32(0)
 	assert.False(t, tree.IsChild(pid, ppid))
 }
 
@@ -211,8 +211,8 @@ func TestIsSibling(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(2, 5)
 
-	pid := 3
-	siblingPid := 5
+	pid := int32(3)
+	siblingPid := int32(5)
 	assert.True(t, tree.IsSibling(pid, siblingPid))
 }
 
@@ -224,8 +224,8 @@ func TestIsSiblingWithInvalidHierarchy(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(2, 5)
 
-	pid := 3
-	siblingPid := 2
+	pid := int32(3)
+	siblingPid := int32(2)
 	assert.False(t, tree.IsSibling(pid, siblingPid))
 }
 
@@ -237,8 +237,8 @@ func TestIsSiblingWithInvalidPid(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(2, 5)
 
-	pid := 0
-	siblingPid := 5
+	pid := int32(0)
+	siblingPid := int32(5)
 	assert.False(t, tree.IsSibling(pid, siblingPid))
 }
 
@@ -250,8 +250,8 @@ func TestIsSiblingWithInvalidSiblingPid(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(2, 5)
 
-	pid := 3
-	siblingPid := 0
+	pid := int32(3)
+	siblingPid := int32(0)
 	assert.False(t, tree.IsSibling(pid, siblingPid))
 }
 
@@ -263,8 +263,8 @@ func TestIsSiblingWithInvalidPids(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(2, 5)
 
-	pid := 0
-	siblingPid := 0
+	pid := int32(0)
+	siblingPid := int32(0)
 	assert.False(t, tree.IsSibling(pid, siblingPid))
 }
 
@@ -276,8 +276,8 @@ func TestIsSiblingWithSamePids(t *testing.T) {
 	tree.AddProcess(2, 3)
 	tree.AddProcess(2, 5)
 
-	pid := 3
-	siblingPid := 3
+	pid := int32(3)
+	siblingPid := int32(3)
 	assert.False(t, tree.IsSibling(pid, siblingPid))
 }
 
@@ -295,8 +295,8 @@ func TestIsAncestor(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	pid := 9
-	ancestorPid := 5
+	pid := int32(9)
+	ancestorPid := int32(5)
 	assert.True(t, tree.IsAncestor(pid, ancestorPid))
 }
 
@@ -314,8 +314,8 @@ func TestIsAncestorWithSamePids(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	pid := 5
-	ancestorPid := 5
+	pid := int32(5)
+	ancestorPid := int32(5)
 	assert.False(t, tree.IsAncestor(pid, ancestorPid))
 }
 
@@ -325,8 +325,8 @@ func TestIsAncestorWithInvalidDescendantPid(t *testing.T) {
 	//      5 -> 8 -> 9
 	tree := NewProcessTree()
 
-	pid := 0
-	ancestorPid := 5
+	pid := int32(0)
+	ancestorPid := int32(5)
 	assert.False(t, tree.IsAncestor(pid, ancestorPid))
 }
 
@@ -336,8 +336,8 @@ func TestIsAncestorWithInvalidAncestorPid(t *testing.T) {
 	//      5 -> 8 -> 9
 	tree := NewProcessTree()
 
-	pid := 5
-	ancestorPid := 0
+	pid := int32(5)
+	ancestorPid := int32(0)
 	assert.False(t, tree.IsAncestor(pid, ancestorPid))
 }
 
@@ -347,8 +347,8 @@ func TestIsAncestorWithInvalidPids(t *testing.T) {
 	//      5 -> 8 -> 9
 	tree := NewProcessTree()
 
-	pid := 0
-	ancestorPid := 0
+	pid := int32(0)
+	ancestorPid := int32(0)
 	assert.False(t, tree.IsAncestor(pid, ancestorPid))
 }
 
@@ -366,8 +366,8 @@ func TestIsDescendant(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	pid := 5
-	descendantPid := 9
+	pid := int32(5)
+	descendantPid := int32(9)
 	assert.True(t, tree.IsDescendant(pid, descendantPid))
 }
 
@@ -385,8 +385,8 @@ func TestIsDescendantWithSamePids(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	pid := 5
-	descendantPid := 5
+	pid := int32(5)
+	descendantPid := int32(5)
 	assert.False(t, tree.IsDescendant(pid, descendantPid))
 }
 
@@ -404,8 +404,8 @@ func TestIsDescendantWithInvalidPid(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	pid := 0
-	descendantPid := 9
+	pid := int32(0)
+	descendantPid := int32(9)
 	assert.False(t, tree.IsDescendant(pid, descendantPid))
 }
 
@@ -423,8 +423,8 @@ func TestIsDescendantWithInvalidDescendantPid(t *testing.T) {
 	tree.AddProcess(5, 8)
 	tree.AddProcess(8, 9)
 
-	pid := 5
-	descendantPid := 0
+	pid := int32(5)
+	descendantPid := int32(0)
 	assert.False(t, tree.IsDescendant(pid, descendantPid))
 }
 
@@ -434,7 +434,131 @@ func TestIsDescendantWithInvalidPids(t *testing.T) {
 	//      5 -> 8 -> 9
 	tree := NewProcessTree()
 
-	pid := 0
-	descendantPid := 0
+	pid := int32(0)
+	descendantPid := int32(0)
 	assert.False(t, tree.IsDescendant(pid, descendantPid))
 }
+
+func TestExitProcessKeepsOrphans(t *testing.T) {
+	// 1 -> 2 -> 3 -> 4
+	tree := NewProcessTree()
+	tree.AddProcess(1, 2)
+	tree.AddProcess(2, 3)
+	tree.AddProcess(3, 4)
+
+	// 3 is kept until 4 exits so that 4 remains a descendant of 2.
+	tree.ExitProcess(3)
+	assert.True(t, tree.IsDescendantOf(4, 2))
+	assert.Equal(t, 3, tree.Len())
+
+	tree.ExitProcess(4)
+	assert.Equal(t, 1, tree.Len())
+	assert.Empty(t, tree.GetChildPids(2))
+}
+
+func TestAddProcessWithReusedPid(t *testing.T) {
+	// 1 -> 2 -> 3 -> 4
+	tree := NewProcessTree()
+	tree.AddProcess(1, 2)
+	tree.AddProcess(2, 3)
+	tree.AddProcess(3, 4)
+	tree.ExitProcess(3)
+
+	// PID 3 is reused by a child of 1, so 4 is adopted by 2.
+	tree.AddProcess(1, 3)
+	assert.True(t, tree.IsParent(3, 1))
+	assert.True(t, tree.IsParent(4, 2))
+	assert.Empty(t, tree.GetChildPids(3))
+	assert.Equal(t, []int32{4}, tree.GetChildPids(2))
+}
+
+func TestUpdateProcessTree(t *testing.T) {
+	tree := NewProcessTree()
+	tree.Update([]ProcessIdentity{{PID: 2, PPID: 1}, {PID: 3, PPID: 2}}, nil)
+	assert.True(t, tree.IsDescendantOf(3, 1))
+
+	// 3 exited and 2 was replaced by a new process with the same PID.
+	tree.Update([]ProcessIdentity{{PID: 2, PPID: 4}}, []ProcessIdentity{{PID: 2, PPID: 1}, {PID: 3, PPID: 2}})
+	assert.True(t, tree.IsParent(2, 4))
+	assert.Empty(t, tree.GetChildPids(2))
+	assert.Equal(t, 1, tree.Len())
+}
+
+// newBenchmarkProcessIdentities returns the identities of n processes, each of which has up to 8 children (i.e. a tree with a depth of about log8(n)).
+func newBenchmarkProcessIdentities(n int) []ProcessIdentity {
+	ids := make([]ProcessIdentity, n)
+	for i := range ids {
+		pid := int32(i + 1)
+		ids[i] = ProcessIdentity{PID: pid, PPID: pid / 8, StartTime: uint64(pid)}
+	}
+	return ids
+}
+
+// scanChildPids finds the children of a process by scanning every process, as the tree did before it had a children index.
+func scanChildPids(t *ProcessTree, pid int32) []int32 {
+	children := []int32{}
+	for p, parent := range t.pidToPpid {
+		if pid == parent {
+			children = append(children, p)
+		}
+	}
+	return children
+}
+
+// scanIsDescendantOf finds every descendant of a process by scanning for children at each level, as the tree did before it had a children index.
+func scanIsDescendantOf(t *ProcessTree, descendantPid, pid int32) bool {
+	for _, child := range scanChildPids(t, pid) {
+		if child == descendantPid || scanIsDescendantOf(t, descendantPid, child) {
+			return true
+		}
+	}
+	return false
+}
+
+func BenchmarkGetChildPids(b *testing.B) {
+	tree := NewProcessTreeFromProcessIdentities(newBenchmarkProcessIdentities(10000))
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.GetChildPids(100)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanChildPids(tree, 100)
+		}
+	})
+}
+
+func BenchmarkIsDescendantOf(b *testing.B) {
+	tree := NewProcessTreeFromProcessIdentities(newBenchmarkProcessIdentities(10000))
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.IsDescendantOf(9999, 156)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanIsDescendantOf(tree, 9999, 156)
+		}
+	})
+}
+
+func BenchmarkUpdateProcessTree(b *testing.B) {
+	// A poll in which one process exited and another started.
+	ids := newBenchmarkProcessIdentities(10000)
+	exited := ids[len(ids)-1:]
+	started := []ProcessIdentity{{PID: 10001, PPID: 1}}
+
+	b.Run("incremental", func(b *testing.B) {
+		tree := NewProcessTreeFromProcessIdentities(ids)
+		for i := 0; i < b.N; i++ {
+			tree.Update(started, exited)
+			tree.Update(exited, started)
+		}
+	})
+	b.Run("rebuild", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewProcessTreeFromProcessIdentities(ids)
+		}
+	})
+}
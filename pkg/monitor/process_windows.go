@@ -0,0 +1,17 @@
+package monitor
+
+import (
+	"github.com/pkg/errors"
+)
+
+func getProcessCredentials(pid int32) (*ProcessCredentials, error) {
+	return nil, errors.New("not implemented")
+}
+
+func getProcessSession(pid int32) (*processSession, error) {
+	return nil, errors.New("not implemented")
+}
+
+func getProcessEnvironment(pid int32) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Sink is a destination for events. Library users can implement their own sinks.
+type Sink interface {
+	Write(e Event) error
+	Close() error
+}
+
+// OpenSink opens a sink from a URI (e.g. stdout, file:///var/log/go-audit.jsonl?max_size=100MB&max_age=24h&compress=true, unix:///run/go-audit.sock).
+func OpenSink(uri string) (Sink, error) {
+	if uri == "stdout" || uri == "-" {
+		return NewWriterSink(os.Stdout), nil
+	}
+	if uri == "stderr" {
+		return NewWriterSink(os.Stderr), nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid sink: %s", uri)
+	}
+	path := u.Path
+	if path == "" {
+		path = u.Opaque
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "file", "":
+		opts, err := parseFileSinkOptions(u.Query())
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sink: %s", uri)
+		}
+		return NewFileSink(path, opts)
+	case "unix":
+		return NewUnixSocketSink(path)
+	}
+	return nil, errors.Errorf("invalid sink: %s (unsupported scheme: %s)", uri, u.Scheme)
+}
+
+// OpenSinks opens a sink for each URI, writing to all of them if there is more than one.
+func OpenSinks(uris []string) (Sink, error) {
+	var sinks MultiSink
+	for _, uri := range uris {
+		s, err := OpenSink(uri)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// WriterSink writes events as newline-delimited JSON.
+type WriterSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (s *WriterSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+func (s *WriterSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok && s.w != os.Stdout && s.w != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+// MultiSink writes each event to all of its sinks.
+type MultiSink []Sink
+
+func (s MultiSink) Write(e Event) error {
+	var errs []error
+	for _, sink := range s {
+		err := sink.Write(e)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (s MultiSink) Close() error {
+	var errs []error
+	for _, sink := range s {
+		err := sink.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,260 @@
+package monitor
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+	"github.com/whitfieldsdad/go-audit/pkg/util"
+)
+
+const rotatedFileTimeFormat = "20060102T150405.000000000"
+
+// rotatedFileSuffixPattern matches the suffix added to the path of a rotated file (e.g. .20240206T111638.688000000.gz).
+var rotatedFileSuffixPattern = regexp.MustCompile(`^\.[0-9]{8}T[0-9]{6}\.[0-9]{9}(\.gz)?$`)
+
+type FileSinkOptions struct {
+	// MaxSize is the size in bytes at which the file is rotated (0 = never).
+	MaxSize int64
+
+	// MaxAge is the age at which the file is rotated (0 = never).
+	MaxAge time.Duration
+
+	// MaxBackups is the number of rotated files to keep (0 = all).
+	MaxBackups int
+
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// FileSink appends events to a file as newline-delimited JSON, rotating it by size and/or age.
+type FileSink struct {
+	path     string
+	opts     FileSinkOptions
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openTime time.Time
+
+	// Rotated files are compressed and pruned in the background, one at a time.
+	wg       sync.WaitGroup
+	backupMu sync.Mutex
+}
+
+func NewFileSink(path string, opts *FileSinkOptions) (*FileSink, error) {
+	if path == "" {
+		return nil, errors.New("no path provided")
+	}
+	if opts == nil {
+		opts = &FileSinkOptions{}
+	}
+	s := &FileSink{
+		path: path,
+		opts: *opts,
+	}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func parseFileSinkOptions(q url.Values) (*FileSinkOptions, error) {
+	opts := &FileSinkOptions{}
+	var err error
+	if v := q.Get("max_size"); v != "" {
+		opts.MaxSize, err = util.ParseByteSize(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid max_size")
+		}
+	}
+	if v := q.Get("max_age"); v != "" {
+		opts.MaxAge, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid max_age")
+		}
+	}
+	if v := q.Get("max_backups"); v != "" {
+		opts.MaxBackups, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid max_backups")
+		}
+	}
+	if v := q.Get("compress"); v != "" {
+		opts.Compress, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid compress")
+		}
+	}
+	return opts, nil
+}
+
+func (s *FileSink) open() error {
+	err := os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create directory")
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return errors.Wrap(err, "failed to open file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to stat file")
+	}
+	s.f = f
+	s.size = info.Size()
+	s.openTime = time.Now()
+	return nil
+}
+
+func (s *FileSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return errors.New("file sink is closed")
+	}
+	if s.shouldRotate(int64(len(b))) {
+		err = s.rotate()
+		if err != nil {
+			if s.f == nil {
+				return err
+			}
+			log.Warnf("Failed to rotate file, appending to it instead: %v (path: %s)", err, s.path)
+		}
+	}
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) shouldRotate(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.opts.MaxSize > 0 && s.size+n > s.opts.MaxSize {
+		return true
+	}
+	return s.opts.MaxAge > 0 && time.Since(s.openTime) >= s.opts.MaxAge
+}
+
+func (s *FileSink) rotate() error {
+	err := s.f.Close()
+	if err != nil {
+		return err
+	}
+	s.f = nil
+
+	rotated := s.path + "." + time.Now().UTC().Format(rotatedFileTimeFormat)
+	err = os.Rename(s.path, rotated)
+	if err != nil {
+		// Keep writing to the original path rather than losing every event from now on.
+		openErr := s.open()
+		if openErr != nil {
+			return openErr
+		}
+		return errors.Wrap(err, "failed to rotate file")
+	}
+	log.Debugf("Rotated %s to %s", s.path, rotated)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.backupMu.Lock()
+		defer s.backupMu.Unlock()
+		if s.opts.Compress {
+			// The file may have already been pruned by a later rotation.
+			err := compressFile(rotated)
+			if err != nil && !os.IsNotExist(err) {
+				log.Warnf("Failed to compress rotated file: %v (path: %s)", err, rotated)
+			}
+		}
+		s.removeBackups()
+	}()
+	return s.open()
+}
+
+// removeBackups removes the oldest rotated files if there are more than MaxBackups of them.
+func (s *FileSink) removeBackups() {
+	if s.opts.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(s.path + ".*")
+	if err != nil {
+		return
+	}
+	// Other files which share the prefix (e.g. a .bak file) aren't backups.
+	var paths []string
+	for _, path := range matches {
+		if rotatedFileSuffixPattern.MatchString(strings.TrimPrefix(path, s.path)) {
+			paths = append(paths, path)
+		}
+	}
+	// The timestamp suffix sorts chronologically.
+	sort.Strings(paths)
+	for len(paths) > s.opts.MaxBackups {
+		err := os.Remove(paths[0])
+		if err != nil {
+			log.Warnf("Failed to remove rotated file: %v (path: %s)", err, paths[0])
+		}
+		paths = paths[1:]
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(dst)
+	_, err = io.Copy(w, src)
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.f != nil {
+		err = s.f.Close()
+		s.f = nil
+	}
+	s.wg.Wait()
+	return err
+}
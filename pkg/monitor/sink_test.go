@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	// Only the files written by rotation are pruned.
+	unrelated := path + ".bak"
+	assert.Nil(t, os.WriteFile(unrelated, []byte("keep me"), 0o600))
+	sink, err := OpenSink("file://" + path + "?max_size=1KB&max_backups=2&compress=true")
+	assert.Nil(t, err)
+
+	for i := 0; i < 20; i++ {
+		err = sink.Write(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: int32(i), Name: "test"}}))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, sink.Close())
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(1024))
+
+	rotated, err := filepath.Glob(path + ".*.gz")
+	assert.Nil(t, err)
+	assert.Len(t, rotated, 2)
+	assert.FileExists(t, unrelated)
+}
+
+func TestFileSinkRotationFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	sink, err := NewFileSink(path, &FileSinkOptions{MaxSize: 100})
+	assert.Nil(t, err)
+	defer sink.Close()
+	e := NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 1, Name: "test"}})
+	assert.Nil(t, sink.Write(e))
+
+	// The file can't be renamed if it's been deleted, in which case it's recreated.
+	assert.Nil(t, os.Remove(path))
+	assert.Nil(t, sink.Write(e))
+	assert.Nil(t, sink.Write(e))
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"pid":1`)
+}
+
+func TestUnixSocketSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	l, err := net.Listen("unix", path)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	sink, err := OpenSink("unix://" + path)
+	assert.Nil(t, err)
+	defer sink.Close()
+	assert.Nil(t, sink.Write(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{PID: 1}})))
+	assert.Contains(t, <-lines, `"pid":1`)
+}
+
+func TestOpenSinkInvalid(t *testing.T) {
+	for _, uri := range []string{"http://localhost", "file:///tmp/x?max_size=lots", "file:///tmp/x?max_age=1"} {
+		_, err := OpenSink(uri)
+		assert.NotNil(t, err, uri)
+	}
+}
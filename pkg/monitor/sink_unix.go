@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	unixSocketSinkDialTimeout  = time.Second
+	unixSocketSinkWriteTimeout = 5 * time.Second
+)
+
+// UnixSocketSink sends events to a Unix domain socket as newline-delimited JSON, reconnecting if the connection is lost.
+type UnixSocketSink struct {
+	path string
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewUnixSocketSink(path string) (*UnixSocketSink, error) {
+	if path == "" {
+		return nil, errors.New("no path provided")
+	}
+	s := &UnixSocketSink{path: path}
+	err := s.connect()
+	if err != nil {
+		// The listener may not have started yet, so we'll try again on the next write.
+		log.Warnf("Failed to connect to %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *UnixSocketSink) connect() error {
+	conn, err := net.DialTimeout("unix", s.path, unixSocketSinkDialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *UnixSocketSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		err = s.connect()
+		if err != nil {
+			return errors.Wrapf(err, "failed to connect to %s", s.path)
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(unixSocketSinkWriteTimeout))
+	_, err = s.conn.Write(b)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return errors.Wrapf(err, "failed to write to %s", s.path)
+	}
+	return nil
+}
+
+func (s *UnixSocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"github.com/charmbracelet/log"
+)
+
+// GetProcessSnapshot returns a running event for each process which matches the filter.
+func GetProcessSnapshot(f *ProcessFilter, opts *ProcessOptions) ([]Event, error) {
+	processes, err := ListProcesses(opts)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := GetProcessTree()
+	if err != nil {
+		return nil, err
+	}
+	var hashOpts *HashOptions
+	if opts != nil {
+		hashOpts = opts.HashOptions
+	}
+	var events []Event
+	for _, p := range f.FilterProcesses(processes, tree, hashOpts) {
+		events = append(events, NewEvent(ObjectTypeProcess, EventTypeRunning, ProcessStartEventData{Process: p}))
+	}
+	return events, nil
+}
+
+// emitSnapshot emits a running event for each matching process. It's called once the monitor is ready, so that every process is reported as either running or started.
+func (m *AuditMonitor) emitSnapshot() {
+	processes, err := ListProcesses(m.getProcessOptions())
+	if err != nil {
+		log.Errorf("Failed to list processes: %v", err)
+		return
+	}
+	tree, err := GetProcessTree()
+	if err != nil {
+		log.Errorf("Failed to get process tree: %v", err)
+		return
+	}
+	for i := range processes {
+		m.cacheProcess(&processes[i])
+	}
+	matched := m.ProcessFilter.FilterProcesses(processes, tree, m.Options.HashOptions)
+	log.Infof("Snapshot of %d running processes", len(matched))
+	for _, p := range matched {
+		m.setAncestors(&p, tree)
+		m.emitProcessEvent(NewEvent(ObjectTypeProcess, EventTypeRunning, ProcessStartEventData{Process: p}))
+	}
+}
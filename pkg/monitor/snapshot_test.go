@@ -0,0 +1,23 @@
+package monitor
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmitSnapshot(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.ProcessFilter = &ProcessFilter{PIDs: []int32{int32(os.Getpid())}}
+	m.Options.IncludeCwd = true
+	m.emitSnapshot()
+
+	// The running processes are described using the same options as new processes.
+	events := readEvents(m)
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventType(EventTypeRunning), events[0].Header.EventType)
+	cwd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Equal(t, cwd, events[0].Data.(ProcessStartEventData).Cwd)
+}
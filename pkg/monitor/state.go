@@ -0,0 +1,217 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/errors"
+)
+
+// monitorState is periodically written to AuditMonitorOptions.StatePath so that the monitor can catch up on what happened while it wasn't running.
+type monitorState struct {
+	// Time is when the state was saved (i.e. the monitor was running until at least then).
+	Time          time.Time  `json:"time"`
+	LastEventTime *time.Time `json:"last_event_time,omitempty"`
+
+	// Processes are the running processes that have been reported as started (or running) by GUID.
+	Processes map[string]*ProcessStopEventData `json:"processes"`
+}
+
+type stateFile struct {
+	path  string
+	mu    sync.Mutex
+	state monitorState
+}
+
+func newStateFile(path string) *stateFile {
+	return &stateFile{
+		path: path,
+		state: monitorState{
+			Processes: make(map[string]*ProcessStopEventData),
+		},
+	}
+}
+
+// readStateFile reads the state saved by a previous run, or returns nil if there isn't one.
+func readStateFile(path string) (*monitorState, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var s monitorState
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "malformed state file: %s", path)
+	}
+	return &s, nil
+}
+
+// observe records the processes which have been reported as started or stopped.
+func (f *stateFile) observe(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := e.Header.Time
+	f.state.LastEventTime = &t
+	switch data := e.Data.(type) {
+	case ProcessStartEventData:
+		if data.GUID == "" {
+			return
+		}
+		ppid := data.PPID
+		f.state.Processes[data.GUID] = &ProcessStopEventData{
+			GUID:       data.GUID,
+			ParentGUID: data.ParentGUID,
+			PID:        data.PID,
+			PPID:       &ppid,
+			CreateTime: data.CreateTime,
+		}
+	case ProcessStopEventData:
+		delete(f.state.Processes, data.GUID)
+	}
+}
+
+func (f *stateFile) add(data *ProcessStopEventData) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.Processes[data.GUID] = data
+}
+
+func (f *stateFile) isKnown(guid string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.state.Processes[guid]
+	return ok
+}
+
+// Save atomically writes the state, forgetting about the processes which are no longer running (e.g. because the backend doesn't report stop events).
+func (f *stateFile) Save() error {
+	running, err := getRunningProcessGUIDs()
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	for guid := range f.state.Processes {
+		if _, ok := running[guid]; !ok {
+			delete(f.state.Processes, guid)
+		}
+	}
+	f.state.Time = time.Now()
+	b, err := json.Marshal(f.state)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func getRunningProcessGUIDs() (map[string]struct{}, error) {
+	ids, err := listProcessIdentities()
+	if err != nil {
+		return nil, err
+	}
+	guids := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if guid := id.GUID(); guid != "" {
+			guids[guid] = struct{}{}
+		}
+	}
+	return guids, nil
+}
+
+// saveState backfills the events missed since the previous state was saved once the monitor is ready, and then periodically saves the state until the context is cancelled (saving it one last time).
+func (m *AuditMonitor) saveState(ctx context.Context, previous *monitorState) {
+	select {
+	case <-m.Ready():
+	case <-ctx.Done():
+		return
+	}
+	if previous != nil {
+		m.backfill(previous)
+	}
+	ticker := time.NewTicker(m.Options.StateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			err := m.state.Save()
+			if err != nil {
+				log.Errorf("Failed to save state: %v", err)
+			}
+			return
+		case <-ticker.C:
+			err := m.state.Save()
+			if err != nil {
+				log.Errorf("Failed to save state: %v", err)
+			}
+		}
+	}
+}
+
+// backfill emits the events which were missed since the previous state was saved: a stop event for each process which has exited, and a start event for each matching process which was started in the meantime. Both are marked as backfilled.
+func (m *AuditMonitor) backfill(previous *monitorState) {
+	running, err := getRunningProcessGUIDs()
+	if err != nil {
+		log.Errorf("Failed to list processes: %v", err)
+		return
+	}
+	stopped := 0
+	for guid, data := range previous.Processes {
+		if _, ok := running[guid]; ok {
+			// The process is still running, so we'll report it as stopped when it exits.
+			m.state.add(data)
+			continue
+		}
+		e := NewEvent(ObjectTypeProcess, EventTypeStopped, *data)
+		e.Header.Backfilled = true
+		m.emit(e)
+		stopped++
+	}
+
+	processes, err := ListProcesses(m.getProcessOptions())
+	if err != nil {
+		log.Errorf("Failed to list processes: %v", err)
+		return
+	}
+	tree, err := GetProcessTree()
+	if err != nil {
+		log.Errorf("Failed to get process tree: %v", err)
+		return
+	}
+	started := 0
+	for _, p := range m.ProcessFilter.FilterProcesses(processes, tree, m.Options.HashOptions) {
+		if p.GUID == "" || p.CreateTime == nil || !p.CreateTime.After(previous.Time) || m.state.isKnown(p.GUID) {
+			continue
+		}
+		m.setAncestors(&p, tree)
+		e := NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: p})
+		e.Header.Backfilled = true
+		m.emitProcessEvent(e)
+		started++
+	}
+	log.Infof("Backfilled %d started and %d stopped processes since %s", started, stopped, previous.Time.Format(time.RFC3339))
+}
@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	previous, err := readStateFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, previous)
+
+	id, err := getProcessIdentity(int32(os.Getpid()))
+	assert.Nil(t, err)
+	f := newStateFile(path)
+	f.observe(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{GUID: id.GUID(), PID: id.PID, PPID: id.PPID}}))
+	f.observe(NewEvent(ObjectTypeProcess, EventTypeRunning, ProcessStartEventData{Process: Process{GUID: "exited", PID: 1}}))
+	f.observe(NewEvent(ObjectTypeProcess, EventTypeStarted, ProcessStartEventData{Process: Process{GUID: "stopped", PID: 2}}))
+	f.observe(NewEvent(ObjectTypeProcess, EventTypeStopped, ProcessStopEventData{GUID: "stopped", PID: 2}))
+	assert.True(t, f.isKnown("exited"))
+	assert.False(t, f.isKnown("stopped"))
+
+	// Processes which are no longer running are forgotten when the state is saved.
+	assert.Nil(t, f.Save())
+	previous, err = readStateFile(path)
+	assert.Nil(t, err)
+	assert.Len(t, previous.Processes, 1)
+	assert.Equal(t, id.PID, previous.Processes[id.GUID()].PID)
+	assert.NotNil(t, previous.LastEventTime)
+}
+
+func TestBackfill(t *testing.T) {
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.state = newStateFile(filepath.Join(t.TempDir(), "state.json"))
+
+	// Other processes may start while the test is running, so only our own process is considered for started events.
+	id, err := getProcessIdentity(int32(os.Getpid()))
+	assert.Nil(t, err)
+	m.ProcessFilter = &ProcessFilter{PIDs: []int32{id.PID}}
+	ppid := int32(1)
+	previous := &monitorState{
+		Time: time.Now(),
+		Processes: map[string]*ProcessStopEventData{
+			id.GUID(): {GUID: id.GUID(), PID: id.PID},
+			"exited":  {GUID: "exited", PID: 1234, PPID: &ppid},
+		},
+	}
+	m.backfill(previous)
+
+	assert.Len(t, m.Events, 1)
+	e := <-m.Events
+	assert.True(t, e.Header.Backfilled)
+	assert.Equal(t, EventType(EventTypeStopped), e.Header.EventType)
+	assert.Equal(t, "exited", e.Data.(ProcessStopEventData).GUID)
+
+	// The process which is still running will be reported as stopped when it exits.
+	assert.True(t, m.state.isKnown(id.GUID()))
+	assert.False(t, m.state.isKnown("exited"))
+}
+
+func TestSaveStateOnStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m := newTestAuditMonitor(t, OverflowBlock, 10)
+	m.state = newStateFile(path)
+	m.Options.StateInterval = time.Hour
+	m.setReady()
+
+	// The state is saved when the monitor stops, rather than only every StateInterval.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	previous := &monitorState{
+		Processes: map[string]*ProcessStopEventData{
+			"exited": {GUID: "exited", PID: 1234},
+		},
+	}
+	go func() {
+		defer close(done)
+		m.saveState(ctx, previous)
+	}()
+
+	// Wait for the backfilled event so that the state isn't saved because the monitor stopped before it was ready.
+	e := <-m.Events
+	assert.True(t, e.Header.Backfilled)
+	cancel()
+	for running := true; running; {
+		select {
+		case <-m.Events:
+		case <-done:
+			running = false
+		}
+	}
+	assert.FileExists(t, path)
+}
@@ -2,6 +2,12 @@ package monitor
 
 import (
 	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 type User struct {
@@ -14,6 +20,24 @@ type User struct {
 	HomeDir        string   `json:"home_dir"`
 }
 
+type Group struct {
+	GID  uint32 `json:"gid"`
+	Name string `json:"name,omitempty"`
+}
+
+// ProcessCredentials are the user and group IDs of a process.
+type ProcessCredentials struct {
+	RUID uint32 `json:"ruid"`
+	EUID uint32 `json:"euid"`
+	SUID uint32 `json:"suid"`
+	RGID uint32 `json:"rgid"`
+	EGID uint32 `json:"egid"`
+	SGID uint32 `json:"sgid"`
+
+	// Groups are the supplementary groups of the process.
+	Groups []Group `json:"groups,omitempty"`
+}
+
 func GetUserByUsername(username string) (*User, error) {
 	o, err := user.Lookup(username)
 	if err != nil {
@@ -23,6 +47,15 @@ func GetUserByUsername(username string) (*User, error) {
 	return u, nil
 }
 
+func GetUserById(uid string) (*User, error) {
+	o, err := user.LookupId(uid)
+	if err != nil {
+		return nil, err
+	}
+	u := getUser(*o)
+	return u, nil
+}
+
 func getUser(u user.User) *User {
 	gids, _ := u.GroupIds()
 	return &User{
@@ -39,3 +72,107 @@ func getUser(u user.User) *User {
 func calculateUserId(uid string) string {
 	return NewUUID5(GetHostId(), []byte(uid))
 }
+
+var (
+	UserCacheSize = 1024
+
+	// UserLookupRetryInterval is how long a user or group which couldn't be found is remembered before it's looked up again (e.g. because it's since been created).
+	UserLookupRetryInterval = time.Minute
+)
+
+var (
+	userCache     *lru.Cache
+	groupCache    *lru.Cache
+	userCacheOnce sync.Once
+)
+
+// userCacheEntry is a cached lookup, where a nil value expires after UserLookupRetryInterval.
+type userCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func getUserCaches() (*lru.Cache, *lru.Cache) {
+	userCacheOnce.Do(func() {
+		var err error
+		userCache, err = lru.New(UserCacheSize)
+		if err != nil {
+			log.Fatalf("Failed to create user cache: %v", err)
+		}
+		groupCache, err = lru.New(UserCacheSize)
+		if err != nil {
+			log.Fatalf("Failed to create group cache: %v", err)
+		}
+	})
+	return userCache, groupCache
+}
+
+// getCachedLookup returns the result of a lookup, only calling it if it isn't cached (including if it failed recently, since looking up users may be slow, e.g. when using NSS).
+func getCachedLookup(cache *lru.Cache, id uint32, lookup func(id string) interface{}) interface{} {
+	now := time.Now()
+	if v, ok := cache.Get(id); ok {
+		e := v.(userCacheEntry)
+		if e.value != nil || now.Before(e.expires) {
+			return e.value
+		}
+	}
+	e := userCacheEntry{value: lookup(strconv.FormatUint(uint64(id), 10))}
+	if e.value == nil {
+		e.expires = now.Add(UserLookupRetryInterval)
+	}
+	cache.Add(id, e)
+	return e.value
+}
+
+// lookupUser returns the user with the given UID, or nil if there's no such user.
+func lookupUser(uid uint32) *User {
+	users, _ := getUserCaches()
+	v := getCachedLookup(users, uid, func(id string) interface{} {
+		u, err := GetUserById(id)
+		if err != nil {
+			return nil
+		}
+		return u
+	})
+	u, _ := v.(*User)
+	return u
+}
+
+// lookupGroupName returns the name of the group with the given GID, or an empty string if there's no such group.
+func lookupGroupName(gid uint32) string {
+	_, groups := getUserCaches()
+	v := getCachedLookup(groups, gid, func(id string) interface{} {
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return nil
+		}
+		return g.Name
+	})
+	name, _ := v.(string)
+	return name
+}
+
+// setProcessCredentials sets the credentials of a process, resolving the names of its user and groups (see ProcessOptions.IncludeUser for the details of its user).
+func setProcessCredentials(p *Process, creds *ProcessCredentials) {
+	for i, g := range creds.Groups {
+		creds.Groups[i].Name = lookupGroupName(g.GID)
+	}
+	p.Credentials = creds
+	if p.Username == "" {
+		if u := lookupUser(creds.RUID); u != nil {
+			p.Username = u.Username
+		}
+	}
+}
+
+// matchesUser returns true if a process is owned by the user with the given username or UID (either its real or effective UID).
+func matchesUser(p *Process, user string) bool {
+	if p.Username == user || (p.User != nil && p.User.Username == user) {
+		return true
+	}
+	uid, err := strconv.ParseUint(user, 10, 32)
+	if err != nil || p.Credentials == nil {
+		return false
+	}
+	return p.Credentials.RUID == uint32(uid) || p.Credentials.EUID == uint32(uid)
+}
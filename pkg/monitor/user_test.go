@@ -0,0 +1,41 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCachedLookup(t *testing.T) {
+	cache, err := lru.New(2)
+	assert.Nil(t, err)
+	lookups := make(map[string]int)
+	lookup := func(id string) interface{} {
+		lookups[id]++
+		if id == "0" {
+			return "root"
+		}
+		return nil
+	}
+
+	// Successful lookups are cached until they're evicted.
+	assert.Equal(t, "root", getCachedLookup(cache, 0, lookup))
+	assert.Equal(t, "root", getCachedLookup(cache, 0, lookup))
+	assert.Equal(t, 1, lookups["0"])
+
+	// Failed lookups are only cached until they expire.
+	assert.Nil(t, getCachedLookup(cache, 1000, lookup))
+	assert.Nil(t, getCachedLookup(cache, 1000, lookup))
+	assert.Equal(t, 1, lookups["1000"])
+	v, _ := cache.Get(uint32(1000))
+	cache.Add(uint32(1000), userCacheEntry{expires: v.(userCacheEntry).expires.Add(-UserLookupRetryInterval - time.Second)})
+	assert.Nil(t, getCachedLookup(cache, 1000, lookup))
+	assert.Equal(t, 2, lookups["1000"])
+
+	// The cache is bounded.
+	getCachedLookup(cache, 1001, lookup)
+	assert.Equal(t, 2, cache.Len())
+	assert.False(t, cache.Contains(uint32(0)))
+}
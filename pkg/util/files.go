@@ -3,6 +3,7 @@ package util
 import (
 	"io/fs"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -15,29 +16,44 @@ func CreateDirectoryWatcher(root string, recursive bool) (*fsnotify.Watcher, err
 	if err != nil {
 		return nil, err
 	}
-	defer watcher.Close()
+	total, err := AddDirectory(watcher, root, recursive)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	log.Infof("Watching %d directories for changes", total)
+	return watcher, nil
+}
 
-	total := 0
-	if recursive {
-		for path := range IterSubdirectories(root) {
-			err = watcher.Add(path)
-			if err != nil {
-				return nil, err
-			}
-			total++
-		}
-	} else {
+// AddDirectory adds a directory (and if recursive, all of its subdirectories) to a watcher, returning the number of directories added.
+func AddDirectory(watcher *fsnotify.Watcher, root string, recursive bool) (int, error) {
+	// The walk below skips directories which can't be read, including the root.
+	_, err := os.Stat(root)
+	if err != nil {
+		return 0, err
+	}
+	if !recursive {
 		log.Debugf("Watching directory %s", root)
-		err = watcher.Add(root)
+		return 1, watcher.Add(root)
+	}
+	total := 0
+	ch := IterSubdirectories(root)
+	for path := range ch {
+		err := watcher.Add(path)
 		if err != nil {
-			return nil, err
+			// Let the walk finish so that it doesn't block forever.
+			go func() {
+				for range ch {
+				}
+			}()
+			return total, err
 		}
 		total++
 	}
-	log.Infof("Watching %d directories for changes", total)
-	return watcher, nil
+	return total, nil
 }
 
+// IterSubdirectories returns the paths to a directory and all of its subdirectories.
 func IterSubdirectories(path string) chan string {
 	ch := make(chan string)
 	total := 0
@@ -50,8 +66,13 @@ func IterSubdirectories(path string) chan string {
 
 		fsys := os.DirFS(path)
 		fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// e.g. a directory which we aren't allowed to read, or which was deleted while we were walking the tree.
+				log.Debugf("Failed to read %s: %v", filepath.Join(path, p), err)
+				return nil
+			}
 			if d.IsDir() {
-				ch <- p
+				ch <- filepath.Join(path, p)
 				total++
 			}
 			return nil